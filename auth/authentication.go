@@ -20,5 +20,9 @@ package auth
 import "context"
 
 type Authentication interface {
+	// Signature returns the signature carrying the id of the signing key.
 	Signature(ctx context.Context) (string, error)
+
+	// Verify returns error if the signature is invalid.
+	Verify(ctx context.Context, signature string) error
 }
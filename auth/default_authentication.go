@@ -22,21 +22,48 @@ import (
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
+	"strings"
 )
 
-const (
-	DefaultSignatureKey = "neve-webhook-key-H*o2A@_M"
-)
+var InvalidAuthenticationErr = errors.New("Invalid authentication ")
 
-type SimpleAuthentication string
+// SimpleAuthentication signs data with the active key of keyring, signatures are "<key id>:<hex of HMAC-SHA256>".
+type SimpleAuthentication struct {
+	data    string
+	keyring Keyring
+}
 
-func NewSimpleAuthentication(secret string) *SimpleAuthentication {
-	ret := SimpleAuthentication(secret)
-	return &ret
+func NewSimpleAuthentication(data string, keyring Keyring) *SimpleAuthentication {
+	return &SimpleAuthentication{
+		data:    data,
+		keyring: keyring,
+	}
 }
 
 func (a *SimpleAuthentication) Signature(ctx context.Context) (string, error) {
-	return HmacSignature(DefaultSignatureKey, string(*a))
+	key, err := a.keyring.Active()
+	if err != nil {
+		return "", err
+	}
+	return key.ID + ":" + hex.EncodeToString(HmacSha256(key.Secret, []byte(a.data))), nil
+}
+
+// Verify verifies the signature by the key of its id, retired keys included.
+func (a *SimpleAuthentication) Verify(ctx context.Context, signature string) error {
+	kid, sig, ok := strings.Cut(signature, ":")
+	if !ok {
+		return InvalidAuthenticationErr
+	}
+	key, ok := a.keyring.Get(kid)
+	if !ok {
+		return InvalidAuthenticationErr
+	}
+	expect := hex.EncodeToString(HmacSha256(key.Secret, []byte(a.data)))
+	if !hmac.Equal([]byte(sig), []byte(expect)) {
+		return InvalidAuthenticationErr
+	}
+	return nil
 }
 
 func HmacSignature(key, data string) (string, error) {
@@ -0,0 +1,202 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+const (
+	// Ed25519SignatureVersion is the version prefix of asymmetric signatures of Standard Webhooks.
+	Ed25519SignatureVersion = "v1a"
+)
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	X   string `json:"x,omitempty"`
+	// Parameters of EC and RSA keys
+	Y string `json:"y,omitempty"`
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Ed25519PublicKey returns the public key of OKP/Ed25519 JWK.
+func (k JWK) Ed25519PublicKey() (ed25519.PublicKey, error) {
+	if k.Kty != "OKP" || k.Crv != "Ed25519" {
+		return nil, fmt.Errorf("Key %s is not an Ed25519 key ", k.Kid)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, err
+	}
+	if len(x) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("Key %s has invalid size ", k.Kid)
+	}
+	return x, nil
+}
+
+// Ed25519Keyring holds Ed25519 keys with ids, the active one signs messages.
+type Ed25519Keyring struct {
+	locker sync.RWMutex
+	keys   map[string]ed25519.PrivateKey
+	ids    []string
+	active string
+}
+
+func NewEd25519Keyring() *Ed25519Keyring {
+	return &Ed25519Keyring{
+		keys: map[string]ed25519.PrivateKey{},
+	}
+}
+
+// Add adds the key, the first added key is active.
+func (k *Ed25519Keyring) Add(id string, key ed25519.PrivateKey) {
+	k.locker.Lock()
+	defer k.locker.Unlock()
+
+	if _, ok := k.keys[id]; !ok {
+		k.ids = append(k.ids, id)
+	}
+	k.keys[id] = key
+	if k.active == "" {
+		k.active = id
+	}
+}
+
+// Generate generates a new key with the id.
+func (k *Ed25519Keyring) Generate(id string) error {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	k.Add(id, key)
+	return nil
+}
+
+// SetActive makes the key of the id sign messages, other keys are still published to verify old messages.
+func (k *Ed25519Keyring) SetActive(id string) error {
+	k.locker.Lock()
+	defer k.locker.Unlock()
+
+	if _, ok := k.keys[id]; !ok {
+		return fmt.Errorf("Key %s not found ", id)
+	}
+	k.active = id
+	return nil
+}
+
+func (k *Ed25519Keyring) Remove(id string) {
+	k.locker.Lock()
+	defer k.locker.Unlock()
+
+	delete(k.keys, id)
+	for i, v := range k.ids {
+		if v == id {
+			k.ids = append(k.ids[:i], k.ids[i+1:]...)
+			break
+		}
+	}
+	if k.active == id {
+		k.active = ""
+		if len(k.ids) > 0 {
+			k.active = k.ids[0]
+		}
+	}
+}
+
+// Sign signs data with the active key.
+func (k *Ed25519Keyring) Sign(data []byte) (keyId string, sig []byte, err error) {
+	keyId, key, err := k.Active()
+	if err != nil {
+		return "", nil, err
+	}
+	return keyId, ed25519.Sign(key, data), nil
+}
+
+// Active returns the active key.
+func (k *Ed25519Keyring) Active() (keyId string, key ed25519.PrivateKey, err error) {
+	k.locker.RLock()
+	defer k.locker.RUnlock()
+
+	key, ok := k.keys[k.active]
+	if !ok {
+		return "", nil, fmt.Errorf("No active Ed25519 key ")
+	}
+	return k.active, key, nil
+}
+
+// JWKS returns public keys of the keyring.
+func (k *Ed25519Keyring) JWKS() JWKSet {
+	k.locker.RLock()
+	defer k.locker.RUnlock()
+
+	ret := JWKSet{
+		Keys: make([]JWK, 0, len(k.ids)),
+	}
+	for _, id := range k.ids {
+		ret.Keys = append(ret.Keys, JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			Kid: id,
+			Use: "sig",
+			Alg: "EdDSA",
+			X:   base64.RawURLEncoding.EncodeToString(k.keys[id].Public().(ed25519.PublicKey)),
+		})
+	}
+	return ret
+}
+
+// Ed25519Signer signs msgId.timestamp.body with the active key of the keyring.
+// Signature is in form of "v1a,<base64>" and the key id is in webhook-key-id header.
+type Ed25519Signer struct {
+	keyring *Ed25519Keyring
+}
+
+func NewEd25519Signer(keyring *Ed25519Keyring) *Ed25519Signer {
+	return &Ed25519Signer{
+		keyring: keyring,
+	}
+}
+
+func (s *Ed25519Signer) Keyring() *Ed25519Keyring {
+	return s.keyring
+}
+
+func (s *Ed25519Signer) Sign(secrets []string, meta SignMeta, body []byte) (http.Header, error) {
+	kid, sig, err := s.keyring.Sign(StandardContent(meta.MsgID, meta.Timestamp.Unix(), body))
+	if err != nil {
+		return nil, err
+	}
+	ret := http.Header{}
+	ret.Set(WebhookSignatureHeader, Ed25519SignatureVersion+","+base64.StdEncoding.EncodeToString(sig))
+	ret.Set(WebhookKeyIDHeader, kid)
+	return ret, nil
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Signing profile of RFC 9421 HTTP Message Signatures with RFC 9530 Content-Digest.
+const (
+	ContentDigestHeader  = "Content-Digest"
+	SignatureInputHeader = "Signature-Input"
+	SignatureHeader      = "Signature"
+	// EventTypeHeader is the header of event type, which is covered by the signature.
+	EventTypeHeader = "X-Neve-WebHook-Event"
+
+	HttpSigAlgHmacSha256 = "hmac-sha256"
+	HttpSigAlgEd25519    = "ed25519"
+)
+
+// HttpSigComponents are the covered components of the signature.
+var HttpSigComponents = []string{"@method", "@target-uri", "content-digest", strings.ToLower(EventTypeHeader)}
+
+var (
+	sigInputPattern = regexp.MustCompile(`([a-zA-Z0-9_*-]+)=\(([^)]*)\)([^,]*)`)
+	sigPattern      = regexp.MustCompile(`([a-zA-Z0-9_*-]+)=:([^:]*):`)
+)
+
+// ContentDigest returns the sha-256 Content-Digest of the body.
+func ContentDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+}
+
+// HttpSigParams is the parameters of a signature, the value of its Signature-Input entry.
+type HttpSigParams struct {
+	Components []string
+	Created    int64
+	KeyID      string
+	Alg        string
+}
+
+func (p HttpSigParams) String() string {
+	buf := strings.Builder{}
+	buf.WriteByte('(')
+	for i, c := range p.Components {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(strconv.Quote(c))
+	}
+	buf.WriteByte(')')
+	buf.WriteString(";created=")
+	buf.WriteString(strconv.FormatInt(p.Created, 10))
+	if p.KeyID != "" {
+		buf.WriteString(";keyid=")
+		buf.WriteString(strconv.Quote(p.KeyID))
+	}
+	if p.Alg != "" {
+		buf.WriteString(";alg=")
+		buf.WriteString(strconv.Quote(p.Alg))
+	}
+	return buf.String()
+}
+
+// HttpSigBase returns the signature base of the components, values are keyed by component names.
+func HttpSigBase(params HttpSigParams, values map[string]string) ([]byte, error) {
+	buf := strings.Builder{}
+	for _, c := range params.Components {
+		v, ok := values[c]
+		if !ok {
+			return nil, fmt.Errorf("Component %s is missing ", c)
+		}
+		buf.WriteString(strconv.Quote(c))
+		buf.WriteString(": ")
+		buf.WriteString(v)
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(`"@signature-params": `)
+	buf.WriteString(params.String())
+	return []byte(buf.String()), nil
+}
+
+// ParseHttpSignatures parses Signature-Input and Signature headers, returns params and signatures keyed by labels.
+func ParseHttpSignatures(header http.Header) (map[string]HttpSigParams, map[string][]byte, error) {
+	params := map[string]HttpSigParams{}
+	for _, m := range sigInputPattern.FindAllStringSubmatch(header.Get(SignatureInputHeader), -1) {
+		p := HttpSigParams{}
+		for _, c := range strings.Fields(m[2]) {
+			v, err := strconv.Unquote(c)
+			if err != nil {
+				return nil, nil, err
+			}
+			p.Components = append(p.Components, v)
+		}
+		for _, kv := range strings.Split(m[3], ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+			if !ok {
+				continue
+			}
+			if uv, err := strconv.Unquote(v); err == nil {
+				v = uv
+			}
+			switch k {
+			case "created":
+				p.Created, _ = strconv.ParseInt(v, 10, 64)
+			case "keyid":
+				p.KeyID = v
+			case "alg":
+				p.Alg = v
+			}
+		}
+		params[m[1]] = p
+	}
+	sigs := map[string][]byte{}
+	for _, m := range sigPattern.FindAllStringSubmatch(header.Get(SignatureHeader), -1) {
+		v, err := base64.StdEncoding.DecodeString(m[2])
+		if err != nil {
+			return nil, nil, err
+		}
+		sigs[m[1]] = v
+	}
+	return params, sigs, nil
+}
+
+// HttpSigSigner signs messages according to RFC 9421, with HMAC-SHA256 of each secret,
+// or with the active Ed25519 key if keyring is not nil.
+type HttpSigSigner struct {
+	keyring *Ed25519Keyring
+}
+
+func NewHttpSigSigner(keyring *Ed25519Keyring) *HttpSigSigner {
+	return &HttpSigSigner{
+		keyring: keyring,
+	}
+}
+
+// Keyring returns the Ed25519 keyring, nil if messages are signed with secrets.
+func (s *HttpSigSigner) Keyring() *Ed25519Keyring {
+	return s.keyring
+}
+
+func (s *HttpSigSigner) Sign(secrets []string, meta SignMeta, body []byte) (http.Header, error) {
+	digest := ContentDigest(body)
+	values := map[string]string{
+		"@method":                        meta.Method,
+		"@target-uri":                    meta.Url,
+		"content-digest":                 digest,
+		strings.ToLower(EventTypeHeader): meta.EventType,
+	}
+	var inputs, sigs []string
+	add := func(params HttpSigParams, sign func(base []byte) ([]byte, error)) error {
+		base, err := HttpSigBase(params, values)
+		if err != nil {
+			return err
+		}
+		sig, err := sign(base)
+		if err != nil {
+			return err
+		}
+		label := "sig" + strconv.Itoa(len(sigs)+1)
+		inputs = append(inputs, label+"="+params.String())
+		sigs = append(sigs, label+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+		return nil
+	}
+
+	if s.keyring != nil {
+		kid, key, err := s.keyring.Active()
+		if err != nil {
+			return nil, err
+		}
+		err = add(HttpSigParams{
+			Components: HttpSigComponents,
+			Created:    meta.Timestamp.Unix(),
+			KeyID:      kid,
+			Alg:        HttpSigAlgEd25519,
+		}, func(base []byte) ([]byte, error) {
+			return ed25519.Sign(key, base), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for _, secret := range secrets {
+			key, err := StandardSecretKey(secret)
+			if err != nil {
+				return nil, err
+			}
+			err = add(HttpSigParams{
+				Components: HttpSigComponents,
+				Created:    meta.Timestamp.Unix(),
+				KeyID:      meta.WebhookID,
+				Alg:        HttpSigAlgHmacSha256,
+			}, func(base []byte) ([]byte, error) {
+				return HmacSha256(key, base), nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	ret := http.Header{}
+	ret.Set(ContentDigestHeader, digest)
+	ret.Set(SignatureInputHeader, strings.Join(inputs, ", "))
+	ret.Set(SignatureHeader, strings.Join(sigs, ", "))
+	return ret, nil
+}
+
+func HmacSha256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	InvalidTokenErr = errors.New("Invalid token ")
+	TokenExpiredErr = errors.New("Token expired ")
+)
+
+// JWTClaims is the registered claims of JWT with scopes, see RFC 7519 and RFC 8693.
+type JWTClaims struct {
+	Issuer    string     `json:"iss,omitempty"`
+	Subject   string     `json:"sub,omitempty"`
+	Audience  StringList `json:"aud,omitempty"`
+	ExpiresAt int64      `json:"exp,omitempty"`
+	NotBefore int64      `json:"nbf,omitempty"`
+	IssuedAt  int64      `json:"iat,omitempty"`
+	Scope     string     `json:"scope,omitempty"`
+	Scopes    StringList `json:"scp,omitempty"`
+	// All claims of the token.
+	Raw map[string]interface{} `json:"-"`
+}
+
+// AllScopes returns scopes of space separated scope claim and scp claim.
+func (c *JWTClaims) AllScopes() []string {
+	return append(strings.Fields(c.Scope), c.Scopes...)
+}
+
+// StringList is a string or an array of strings in json.
+type StringList []string
+
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = StringList{s}
+		return nil
+	}
+	var ret []string
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return err
+	}
+	*l = ret
+	return nil
+}
+
+// ReadJWKSFile reads JWK set in json from the file.
+func ReadJWKSFile(path string) (JWKSet, error) {
+	ret := JWKSet{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ret, err
+	}
+	err = json.Unmarshal(data, &ret)
+	return ret, err
+}
+
+// PublicKey returns the public key of OKP/Ed25519, EC/P-256 or RSA JWK.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "OKP":
+		return k.Ed25519PublicKey()
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("Curve %s of key %s is not supported ", k.Crv, k.Kid)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		ret := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !ret.Curve.IsOnCurve(ret.X, ret.Y) {
+			return nil, fmt.Errorf("Key %s is not on curve ", k.Kid)
+		}
+		return ret, nil
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	}
+	return nil, fmt.Errorf("Key type %s of key %s is not supported ", k.Kty, k.Kid)
+}
+
+// VerifyJWT verifies the signature of EdDSA, ES256 or RS256 token by keys, and checks exp and nbf with leeway.
+func VerifyJWT(token string, keys JWKSet, now time.Time, leeway time.Duration) (*JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, InvalidTokenErr
+	}
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, InvalidTokenErr
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, InvalidTokenErr
+	}
+	content := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range keys.Keys {
+		if (header.Kid != "" && k.Kid != header.Kid) || (k.Alg != "" && k.Alg != header.Alg) {
+			continue
+		}
+		key, err := k.PublicKey()
+		if err != nil {
+			continue
+		}
+		if verifyJWS(header.Alg, key, content, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, InvalidTokenErr
+	}
+	claims := &JWTClaims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, InvalidTokenErr
+	}
+	if err := decodeSegment(parts[1], &claims.Raw); err != nil {
+		return nil, InvalidTokenErr
+	}
+	if claims.ExpiresAt != 0 && now.Unix() > claims.ExpiresAt+int64(leeway.Seconds()) {
+		return nil, TokenExpiredErr
+	}
+	if claims.NotBefore != 0 && now.Unix()+int64(leeway.Seconds()) < claims.NotBefore {
+		return nil, InvalidTokenErr
+	}
+	return claims, nil
+}
+
+func verifyJWS(alg string, key crypto.PublicKey, content, sig []byte) bool {
+	switch alg {
+	case "EdDSA":
+		if k, ok := key.(ed25519.PublicKey); ok {
+			return ed25519.Verify(k, content, sig)
+		}
+	case "ES256":
+		if k, ok := key.(*ecdsa.PublicKey); ok && len(sig) == 64 {
+			h := sha256.Sum256(content)
+			return ecdsa.Verify(k, h[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]))
+		}
+	case "RS256":
+		if k, ok := key.(*rsa.PublicKey); ok {
+			h := sha256.Sum256(content)
+			return rsa.VerifyPKCS1v15(k, crypto.SHA256, h[:], sig) == nil
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,247 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xfali/fig"
+	"os"
+	"sync"
+)
+
+const (
+	DefaultKeySize = 32
+	// KeyringConfigKey is the fig key of the server keyring authenticating requests of the management API.
+	KeyringConfigKey = "neve.web.hooks.keyring"
+)
+
+var (
+	NoActiveKeyErr  = errors.New("No active key ")
+	KeyNotFoundErr  = errors.New("Key not found ")
+	KeyRetiredErr   = errors.New("Key is retired ")
+	KeyringEmptyErr = errors.New("Keyring is empty ")
+)
+
+// Key is a symmetric key with id.
+type Key struct {
+	ID     string
+	Secret []byte
+	// Retired keys only verify signatures made before rotation.
+	Retired bool
+}
+
+type Keyring interface {
+	// Active returns the key to sign with.
+	Active() (Key, error)
+
+	// Get returns the key of the id, retired included.
+	Get(id string) (Key, bool)
+}
+
+// HmacKeyring holds symmetric keys, one of them is active.
+type HmacKeyring struct {
+	locker sync.RWMutex
+	keys   map[string]*Key
+	ids    []string
+	active string
+}
+
+func NewHmacKeyring() *HmacKeyring {
+	return &HmacKeyring{
+		keys: map[string]*Key{},
+	}
+}
+
+// Add adds the key, the first added key is active.
+func (k *HmacKeyring) Add(id string, secret []byte) {
+	k.locker.Lock()
+	defer k.locker.Unlock()
+
+	if _, ok := k.keys[id]; !ok {
+		k.ids = append(k.ids, id)
+	}
+	k.keys[id] = &Key{ID: id, Secret: secret}
+	if k.active == "" {
+		k.active = id
+	}
+}
+
+// Generate generates a random key with the id.
+func (k *HmacKeyring) Generate(id string) error {
+	secret := make([]byte, DefaultKeySize)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	k.Add(id, secret)
+	return nil
+}
+
+// SetActive makes the key of the id sign, the key must not be retired.
+func (k *HmacKeyring) SetActive(id string) error {
+	k.locker.Lock()
+	defer k.locker.Unlock()
+
+	v, ok := k.keys[id]
+	if !ok {
+		return fmt.Errorf("%w%s ", KeyNotFoundErr, id)
+	}
+	if v.Retired {
+		return fmt.Errorf("%w%s ", KeyRetiredErr, id)
+	}
+	k.active = id
+	return nil
+}
+
+// Retire keeps the key only to verify, the active key can not be retired.
+func (k *HmacKeyring) Retire(id string) error {
+	k.locker.Lock()
+	defer k.locker.Unlock()
+
+	v, ok := k.keys[id]
+	if !ok {
+		return fmt.Errorf("%w%s ", KeyNotFoundErr, id)
+	}
+	if id == k.active {
+		return fmt.Errorf("Key %s is active ", id)
+	}
+	v.Retired = true
+	return nil
+}
+
+func (k *HmacKeyring) Remove(id string) {
+	k.locker.Lock()
+	defer k.locker.Unlock()
+
+	delete(k.keys, id)
+	for i, v := range k.ids {
+		if v == id {
+			k.ids = append(k.ids[:i], k.ids[i+1:]...)
+			break
+		}
+	}
+	if k.active == id {
+		k.active = ""
+	}
+}
+
+func (k *HmacKeyring) Active() (Key, error) {
+	k.locker.RLock()
+	defer k.locker.RUnlock()
+
+	v, ok := k.keys[k.active]
+	if !ok {
+		return Key{}, NoActiveKeyErr
+	}
+	return *v, nil
+}
+
+func (k *HmacKeyring) Get(id string) (Key, bool) {
+	k.locker.RLock()
+	defer k.locker.RUnlock()
+
+	v, ok := k.keys[id]
+	if !ok {
+		return Key{}, false
+	}
+	return *v, true
+}
+
+// Keys returns ids of all keys in added order.
+func (k *HmacKeyring) Keys() []string {
+	k.locker.RLock()
+	defer k.locker.RUnlock()
+
+	return append([]string(nil), k.ids...)
+}
+
+type KeyConfig struct {
+	ID string `json:"id" yaml:"id"`
+	// Base64 encoded secret
+	Secret  string `json:"secret" yaml:"secret"`
+	Retired bool   `json:"retired" yaml:"retired"`
+}
+
+// KeyringConfig is the config of keyring, keys of File (in json) are added after Keys.
+type KeyringConfig struct {
+	Active string      `json:"active" yaml:"active"`
+	File   string      `json:"file" yaml:"file"`
+	Keys   []KeyConfig `json:"keys" yaml:"keys"`
+}
+
+// NewHmacKeyringFromConfig creates keyring from config, the first not retired key is active if Active is empty.
+func NewHmacKeyringFromConfig(conf KeyringConfig) (*HmacKeyring, error) {
+	keys := conf.Keys
+	if conf.File != "" {
+		fileConf, err := ReadKeyringFile(conf.File)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, fileConf.Keys...)
+		if conf.Active == "" {
+			conf.Active = fileConf.Active
+		}
+	}
+	ret := NewHmacKeyring()
+	for _, kc := range keys {
+		if kc.ID == "" {
+			return nil, errors.New("Key id is empty ")
+		}
+		secret, err := base64.StdEncoding.DecodeString(kc.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("Decode key %s failed: %v ", kc.ID, err)
+		}
+		ret.Add(kc.ID, secret)
+		if kc.Retired {
+			ret.keys[kc.ID].Retired = true
+		}
+		if conf.Active == "" && !kc.Retired {
+			conf.Active = kc.ID
+		}
+	}
+	if len(ret.keys) == 0 {
+		return nil, KeyringEmptyErr
+	}
+	if err := ret.SetActive(conf.Active); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ReadKeyringFile reads keyring config in json from the file.
+func ReadKeyringFile(path string) (KeyringConfig, error) {
+	ret := KeyringConfig{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ret, err
+	}
+	err = json.Unmarshal(data, &ret)
+	return ret, err
+}
+
+// LoadHmacKeyring creates keyring from config of the key, e.g. KeyringConfigKey.
+func LoadHmacKeyring(props fig.Properties, key string) (*HmacKeyring, error) {
+	conf := KeyringConfig{}
+	if err := props.GetValue(key, &conf); err != nil {
+		return nil, err
+	}
+	return NewHmacKeyringFromConfig(conf)
+}
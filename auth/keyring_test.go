@@ -0,0 +1,77 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSimpleAuthentication(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	err := os.WriteFile(path, []byte(`{"keys":[{"id":"k2","secret":"ZGVm"}]}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := NewHmacKeyringFromConfig(KeyringConfig{
+		File: path,
+		Keys: []KeyConfig{{ID: "k1", Secret: "YWJj"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	a := NewSimpleAuthentication("test", keyring)
+	old, err := a.Signature(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old[:3] != "k1:" {
+		t.Fatalf("Expect signed by k1 but get %s\n", old)
+	}
+
+	// rotate
+	if err := keyring.SetActive("k2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Retire("k1"); err != nil {
+		t.Fatal(err)
+	}
+	sig, err := a.Signature(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig[:3] != "k2:" {
+		t.Fatalf("Expect signed by k2 but get %s\n", sig)
+	}
+	if err := a.Verify(ctx, sig); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Verify(ctx, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.SetActive("k1"); err == nil {
+		t.Fatal("Expect retired key can not be active")
+	}
+	keyring.Remove("k1")
+	if err := a.Verify(ctx, old); err != InvalidAuthenticationErr {
+		t.Fatalf("Expect invalid but get %v\n", err)
+	}
+}
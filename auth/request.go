@@ -0,0 +1,95 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// RequestAuthScheme is the scheme of Authorization header of HMAC signed requests:
+	// "HMAC-SHA256 KeyId=<key id>,Timestamp=<unix seconds>,Signature=<hex>"
+	RequestAuthScheme = "HMAC-SHA256"
+)
+
+var InvalidRequestAuthErr = errors.New("Invalid HMAC authorization ")
+
+// RequestAuth is the parsed Authorization header of HMAC signed request.
+type RequestAuth struct {
+	KeyID     string
+	Timestamp int64
+	Signature string
+}
+
+// RequestContent returns the signed content: method, request uri, timestamp and hex sha256 of body, joined by '\n'.
+func RequestContent(method, requestUri string, timestamp int64, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	return []byte(strings.Join([]string{
+		method,
+		requestUri,
+		strconv.FormatInt(timestamp, 10),
+		hex.EncodeToString(sum[:]),
+	}, "\n"))
+}
+
+// RequestSignature returns hex of HMAC-SHA256 of the request content.
+func RequestSignature(key Key, method, requestUri string, timestamp int64, body []byte) string {
+	return hex.EncodeToString(HmacSha256(key.Secret, RequestContent(method, requestUri, timestamp, body)))
+}
+
+// SignRequest sets Authorization header of the request signed by the key.
+func SignRequest(req *http.Request, key Key, body []byte, now time.Time) {
+	ts := now.Unix()
+	req.Header.Set("Authorization", RequestAuthScheme+" KeyId="+key.ID+
+		",Timestamp="+strconv.FormatInt(ts, 10)+
+		",Signature="+RequestSignature(key, req.Method, req.URL.RequestURI(), ts, body))
+}
+
+// ParseRequestAuth parses Authorization header, return false if it is not of RequestAuthScheme.
+func ParseRequestAuth(header string) (RequestAuth, bool, error) {
+	ret := RequestAuth{}
+	scheme, params, ok := strings.Cut(header, " ")
+	if !ok || scheme != RequestAuthScheme {
+		return ret, false, nil
+	}
+	for _, kv := range strings.Split(params, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(kv), "=")
+		switch k {
+		case "KeyId":
+			ret.KeyID = v
+		case "Timestamp":
+			ts, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return ret, true, InvalidRequestAuthErr
+			}
+			ret.Timestamp = ts
+		case "Signature":
+			ret.Signature = v
+		}
+	}
+	if ret.KeyID == "" || ret.Timestamp == 0 || ret.Signature == "" {
+		return ret, true, InvalidRequestAuthErr
+	}
+	return ret, true, nil
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// SealedSecretPrefix is the prefix of sealed secrets, followed by "<key id>:<base64 of nonce and cipher text>".
+	SealedSecretPrefix = "sealed:"
+	// SealerKeyringConfigKey is the fig key of the keyring sealing secrets at rest,
+	// it must not share keys with the keyring of KeyringConfigKey which authenticates requests.
+	SealerKeyringConfigKey = "neve.web.hooks.sealer.keyring"
+
+	maskedSecretSuffix = 4
+)
+
+var InvalidSealedSecretErr = errors.New("Invalid sealed secret ")
+
+// SecretSealer encrypts secrets at rest.
+type SecretSealer interface {
+	Seal(secret string) (string, error)
+
+	// Open decrypts the sealed secret.
+	Open(sealed string) (string, error)
+}
+
+// aesGcmSealer seals secrets with AES-256-GCM by keys of keyring, which provides keys locally.
+// Sealed secrets carry the key id, so keys can be rotated while old secrets are still opened by retired keys.
+type aesGcmSealer struct {
+	keyring Keyring
+}
+
+func NewAesGcmSealer(keyring Keyring) *aesGcmSealer {
+	return &aesGcmSealer{
+		keyring: keyring,
+	}
+}
+
+// Seal always seals the secret even if it looks sealed, so that any secret can be opened as it is.
+func (s *aesGcmSealer) Seal(secret string) (string, error) {
+	if secret == "" {
+		return secret, nil
+	}
+	key, err := s.keyring.Active()
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAead(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(secret)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	data := aead.Seal(nonce, nonce, []byte(secret), []byte(key.ID))
+	return SealedSecretPrefix + key.ID + ":" + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// Open returns the secret as it is if it is not sealed, e.g. stored before sealing was enabled.
+func (s *aesGcmSealer) Open(sealed string) (string, error) {
+	if !IsSealed(sealed) {
+		return sealed, nil
+	}
+	kid, v, ok := strings.Cut(sealed[len(SealedSecretPrefix):], ":")
+	if !ok {
+		return "", InvalidSealedSecretErr
+	}
+	key, ok := s.keyring.Get(kid)
+	if !ok {
+		return "", fmt.Errorf("%w%s ", KeyNotFoundErr, kid)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return "", InvalidSealedSecretErr
+	}
+	aead, err := newAead(key)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < aead.NonceSize() {
+		return "", InvalidSealedSecretErr
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(kid))
+	if err != nil {
+		return "", InvalidSealedSecretErr
+	}
+	return string(plain), nil
+}
+
+func newAead(key Key) (cipher.AEAD, error) {
+	// keys of any size are derived to AES-256 keys
+	k := sha256.Sum256(key.Secret)
+	block, err := aes.NewCipher(k[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func IsSealed(secret string) bool {
+	return strings.HasPrefix(secret, SealedSecretPrefix)
+}
+
+// IsMasked returns true if the secret is masked by MaskSecret.
+func IsMasked(secret string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(secret, StandardSecretPrefix), "****")
+}
+
+// MaskSecret hides the secret except its prefix and last characters.
+func MaskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	prefix := ""
+	if strings.HasPrefix(secret, StandardSecretPrefix) {
+		prefix = StandardSecretPrefix
+		secret = secret[len(StandardSecretPrefix):]
+	}
+	if len(secret) <= 2*maskedSecretSuffix {
+		return prefix + "****"
+	}
+	return prefix + "****" + secret[len(secret)-maskedSecretSuffix:]
+}
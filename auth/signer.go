@@ -0,0 +1,48 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"net/http"
+	"time"
+)
+
+// Signature profiles which a webhook may choose.
+const (
+	// Standard Webhooks signature, see StandardSigner
+	SignProfileStandard = "standard"
+	// RFC 9421 HTTP Message Signatures, see HttpSigSigner
+	SignProfileHttpSig = "rfc9421"
+)
+
+// SignMeta is the metadata of a message to be signed.
+type SignMeta struct {
+	// Delivery id, same in retries of a delivery
+	MsgID     string
+	WebhookID string
+	EventType string
+	Timestamp time.Time
+	// Method and url of the request
+	Method string
+	Url    string
+}
+
+type Signer interface {
+	// Sign returns headers carrying signatures of the body, secrets are valid secrets of the webhook.
+	Sign(secrets []string, meta SignMeta, body []byte) (http.Header, error)
+}
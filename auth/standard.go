@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Headers of Standard Webhooks
+	WebhookIDHeader        = "webhook-id"
+	WebhookTimestampHeader = "webhook-timestamp"
+	WebhookSignatureHeader = "webhook-signature"
+	// WebhookKeyIDHeader carries the id of the key signed the message.
+	WebhookKeyIDHeader = "webhook-key-id"
+
+	// StandardSignatureVersion is the version prefix of signatures compatible with Standard Webhooks.
+	StandardSignatureVersion = "v1"
+	// StandardSecretPrefix marks a base64 encoded secret.
+	StandardSecretPrefix = "whsec_"
+)
+
+// StandardSigner signs with HMAC-SHA256 of each secret, signatures are space separated in webhook-signature header.
+type StandardSigner struct{}
+
+func (s StandardSigner) Sign(secrets []string, meta SignMeta, body []byte) (http.Header, error) {
+	var sigs []string
+	for _, secret := range secrets {
+		sig, err := StandardSignature(secret, meta.MsgID, meta.Timestamp.Unix(), body)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, sig)
+	}
+	ret := http.Header{}
+	ret.Set(WebhookSignatureHeader, strings.Join(sigs, " "))
+	return ret, nil
+}
+
+// StandardContent returns the content to be signed: msgId.timestamp.body.
+func StandardContent(msgId string, timestamp int64, body []byte) []byte {
+	buf := bytes.Buffer{}
+	buf.WriteString(msgId)
+	buf.WriteByte('.')
+	buf.WriteString(strconv.FormatInt(timestamp, 10))
+	buf.WriteByte('.')
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// StandardSignature signs msgId.timestamp.body with HMAC-SHA256 keyed by secret,
+// returns the signature in form of "v1,<base64>".
+// Secret with prefix "whsec_" is base64 decoded, otherwise it is used as raw bytes.
+func StandardSignature(secret, msgId string, timestamp int64, body []byte) (string, error) {
+	key, err := StandardSecretKey(secret)
+	if err != nil {
+		return "", err
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write(StandardContent(msgId, timestamp, body))
+	return StandardSignatureVersion + "," + base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// NewStandardSecret generates a random secret with prefix "whsec_".
+func NewStandardSecret() (string, error) {
+	key := make([]byte, 24)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return StandardSecretPrefix + base64.StdEncoding.EncodeToString(key), nil
+}
+
+func StandardSecretKey(secret string) ([]byte, error) {
+	if strings.HasPrefix(secret, StandardSecretPrefix) {
+		return base64.StdEncoding.DecodeString(secret[len(StandardSecretPrefix):])
+	}
+	return []byte(secret), nil
+}
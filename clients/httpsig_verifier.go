@@ -0,0 +1,152 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clients
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"encoding/base64"
+	"errors"
+	"github.com/xfali/neve-webhook/auth"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var InvalidDigestErr = errors.New("Invalid content digest ")
+
+// httpSigVerifier verifies RFC 9421 signatures and the Content-Digest of body.
+// Signatures are HMAC-SHA256 of secrets, or Ed25519 of keys fetched from JWKS if the url is set.
+type httpSigVerifier struct {
+	verifierConfig
+
+	jwks *jwksVerifier
+}
+
+func NewHttpSigVerifier(secret string, opts ...VerifierOpt) *httpSigVerifier {
+	ret := &httpSigVerifier{
+		verifierConfig: newVerifierConfig(opts...),
+	}
+	if secret != "" {
+		ret.secrets = append([]string{secret}, ret.secrets...)
+	}
+	if ret.jwksUrl != "" {
+		ret.jwks = NewJwksVerifier(ret.jwksUrl, opts...)
+	}
+	return ret
+}
+
+func (v *httpSigVerifier) VerifySignature(req *http.Request, body []byte) (int, error) {
+	now := time.Now()
+	digest := req.Header.Get(auth.ContentDigestHeader)
+	params, sigs, err := auth.ParseHttpSignatures(req.Header)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if digest == "" || len(params) == 0 || len(sigs) == 0 {
+		return http.StatusBadRequest, MissingSignatureErr
+	}
+	if !hmac.Equal([]byte(digest), []byte(auth.ContentDigest(body))) {
+		return http.StatusUnauthorized, InvalidDigestErr
+	}
+
+	values := map[string]string{
+		"@method":        req.Method,
+		"@target-uri":    TargetUri(req),
+		"content-digest": digest,
+	}
+	retErr := InvalidSignatureErr
+	for label, p := range params {
+		sig, ok := sigs[label]
+		if !ok || !covers(p.Components, auth.HttpSigComponents) {
+			continue
+		}
+		if math.Abs(float64(now.Unix()-p.Created)) > v.tolerance.Seconds() {
+			retErr = InvalidTimestampErr
+			continue
+		}
+		for _, c := range p.Components {
+			if _, ok := values[c]; !ok && !strings.HasPrefix(c, "@") && len(req.Header.Values(c)) > 0 {
+				values[c] = strings.Join(req.Header.Values(c), ", ")
+			}
+		}
+		base, err := auth.HttpSigBase(p, values)
+		if err != nil {
+			continue
+		}
+		if v.verify(p, base, sig, now) {
+			return v.checkReplay(&signedMessage{
+				id: base64.StdEncoding.EncodeToString(sig),
+				ts: strconv.FormatInt(p.Created, 10),
+			}, now)
+		}
+	}
+	return http.StatusUnauthorized, retErr
+}
+
+func (v *httpSigVerifier) verify(p auth.HttpSigParams, base, sig []byte, now time.Time) bool {
+	switch p.Alg {
+	case auth.HttpSigAlgHmacSha256:
+		for _, secret := range v.secrets {
+			key, err := auth.StandardSecretKey(secret)
+			if err == nil && hmac.Equal(sig, auth.HmacSha256(key, base)) {
+				return true
+			}
+		}
+	case auth.HttpSigAlgEd25519:
+		if v.jwks != nil {
+			key, err := v.jwks.key(p.KeyID, now)
+			return err == nil && ed25519.Verify(key, base, sig)
+		}
+	}
+	return false
+}
+
+// covers returns true if all of the required components are covered.
+func covers(components, required []string) bool {
+	for _, r := range required {
+		found := false
+		for _, c := range components {
+			if c == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// TargetUri returns the absolute uri of the request, the scheme may be forwarded by a proxy.
+func TargetUri(req *http.Request) string {
+	if req.URL.IsAbs() {
+		return req.URL.String()
+	}
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	if v := req.Header.Get("X-Forwarded-Proto"); v != "" {
+		scheme = v
+	}
+	return scheme + "://" + req.Host + req.URL.RequestURI()
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clients
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/xfali/neve-webhook/auth"
+	"github.com/xfali/neve-webhook/notifier"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultJwksRefreshInterval = 10 * time.Minute
+	DefaultJwksFetchTimeout    = 10 * time.Second
+	// Min interval of fetching JWKS again for an unknown key id or after a failure
+	jwksMinRefreshInterval = 10 * time.Second
+)
+
+// jwksVerifier verifies Ed25519 signatures by public keys fetched from a JWKS url.
+type jwksVerifier struct {
+	verifierConfig
+
+	url         string
+	locker      sync.Mutex
+	keys        map[string]ed25519.PublicKey
+	fetchTime   time.Time
+	attemptTime time.Time
+	// Closed when the in-flight fetch is done, nil if not fetching
+	fetching chan struct{}
+}
+
+func NewJwksVerifier(url string, opts ...VerifierOpt) *jwksVerifier {
+	return &jwksVerifier{
+		verifierConfig: newVerifierConfig(opts...),
+		url:            url,
+	}
+}
+
+func (v *jwksVerifier) VerifySignature(req *http.Request, body []byte) (int, error) {
+	now := time.Now()
+	m, code, err := v.parse(req, now)
+	if err != nil {
+		return code, err
+	}
+	key, err := v.key(req.Header.Get(notifier.WebhookKeyIDHeader), now)
+	if err != nil {
+		return http.StatusUnauthorized, err
+	}
+	content := auth.StandardContent(m.id, m.timestamp, body)
+	matched := false
+	for _, s := range strings.Fields(m.signatures) {
+		if !strings.HasPrefix(s, auth.Ed25519SignatureVersion+",") {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(s[len(auth.Ed25519SignatureVersion)+1:])
+		if err == nil && ed25519.Verify(key, content, sig) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return http.StatusUnauthorized, InvalidSignatureErr
+	}
+	return v.checkReplay(m, now)
+}
+
+// key returns the cached key, JWKS is fetched again if the cache expired or the key id is unknown.
+// Only one fetch runs at a time and it is not made more than once per jwksMinRefreshInterval.
+// Keys removed from the JWKS are rejected after it is fetched, the cached key is only used if fetching failed.
+func (v *jwksVerifier) key(kid string, now time.Time) (ed25519.PublicKey, error) {
+	v.locker.Lock()
+	key, ok := v.keys[kid]
+	if (ok && now.Sub(v.fetchTime) < v.refreshInterval) || now.Sub(v.attemptTime) < jwksMinRefreshInterval {
+		v.locker.Unlock()
+		return foundKey(kid, key, ok)
+	}
+	if wait := v.fetching; wait != nil {
+		v.locker.Unlock()
+		if ok {
+			// keep using the cached key while it is being refreshed
+			return key, nil
+		}
+		<-wait
+	} else {
+		wait = make(chan struct{})
+		v.fetching = wait
+		v.attemptTime = now
+		v.locker.Unlock()
+
+		keys, err := v.fetch()
+
+		v.locker.Lock()
+		if err == nil {
+			v.keys = keys
+			v.fetchTime = now
+		}
+		v.fetching = nil
+		close(wait)
+		v.locker.Unlock()
+		if err != nil {
+			if ok {
+				return key, nil
+			}
+			return nil, err
+		}
+	}
+
+	v.locker.Lock()
+	defer v.locker.Unlock()
+	key, ok = v.keys[kid]
+	return foundKey(kid, key, ok)
+}
+
+func foundKey(kid string, key ed25519.PublicKey, ok bool) (ed25519.PublicKey, error) {
+	if ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("Key %s not found ", kid)
+}
+
+func (v *jwksVerifier) fetch() (map[string]ed25519.PublicKey, error) {
+	resp, err := v.client.Get(v.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Fetch JWKS from %s failed, http status: %d ", v.url, resp.StatusCode)
+	}
+	set := auth.JWKSet{}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	ret := map[string]ed25519.PublicKey{}
+	for _, k := range set.Keys {
+		if key, err := k.Ed25519PublicKey(); err == nil {
+			ret[k.Kid] = key
+		}
+	}
+	return ret, nil
+}
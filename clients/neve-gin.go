@@ -18,15 +18,20 @@
 package clients
 
 import (
+	"encoding/json"
 	"github.com/gin-gonic/gin"
 	"github.com/xfali/neve-web/gineve/midware/loghttp"
+	"github.com/xfali/neve-webhook/auth"
+	"github.com/xfali/neve-webhook/events"
 	"github.com/xfali/neve-webhook/notifier"
 	"github.com/xfali/xlog"
 	"net/http"
+	"time"
 )
 
 type SignatureVerifier interface {
-	VerifySignature(signature string) (httpStatus int, err error)
+	// VerifySignature verifies the request with its raw body.
+	VerifySignature(req *http.Request, body []byte) (httpStatus int, err error)
 }
 
 type EventProcessor interface {
@@ -38,11 +43,20 @@ type webHookHandler struct {
 
 	HLog loghttp.HttpLogger `inject:""`
 
-	SignatureVerifier SignatureVerifier `inject:""`
+	// The default verifier is created from config if it is nil
+	SignatureVerifier SignatureVerifier `inject:",omiterror"`
 
 	EventProcessor EventProcessor `inject:""`
 
 	EventsPath string `fig:"neve.web.hooks.routes.events"`
+	// Secret of the webhook for the default verifier
+	Secret string `fig:"neve.web.hooks.client.secret"`
+	// Timestamp tolerance in seconds of the default verifier
+	Tolerance int `fig:"neve.web.hooks.client.tolerance"`
+	// JWKS url of the server, verify Ed25519 signatures instead of secret if it is set
+	JwksUrl string `fig:"neve.web.hooks.client.jwks"`
+	// Signature profile of the webhook, standard or rfc9421
+	Profile string `fig:"neve.web.hooks.client.profile"`
 }
 
 func NewWebHookHandler() *webHookHandler {
@@ -55,6 +69,27 @@ func (o *webHookHandler) HttpRoutes(engine gin.IRouter) {
 	if o.EventsPath == "" {
 		o.EventsPath = "/events"
 	}
+	if o.SignatureVerifier == nil {
+		var opts []VerifierOpt
+		if o.Tolerance > 0 {
+			opts = append(opts, VerifierOpts.SetTolerance(time.Duration(o.Tolerance)*time.Second))
+		}
+		if o.Profile == auth.SignProfileHttpSig {
+			if o.JwksUrl != "" {
+				opts = append(opts, VerifierOpts.SetJwksUrl(o.JwksUrl))
+			} else if o.Secret == "" {
+				o.logger.Warnln("Secret of webhook is empty, signatures can be forged")
+			}
+			o.SignatureVerifier = NewHttpSigVerifier(o.Secret, opts...)
+		} else if o.JwksUrl != "" {
+			o.SignatureVerifier = NewJwksVerifier(o.JwksUrl, opts...)
+		} else {
+			if o.Secret == "" {
+				o.logger.Warnln("Secret of webhook is empty, signatures can be forged")
+			}
+			o.SignatureVerifier = NewStandardVerifier(o.Secret, opts...)
+		}
+	}
 	engine.POST(o.EventsPath, o.HLog.LogHttp(), o.events)
 }
 
@@ -65,14 +100,25 @@ func (o *webHookHandler) events(ctx *gin.Context) {
 		return
 	}
 	t := ctx.GetHeader(notifier.EventTypeHeader)
-	s := ctx.GetHeader(notifier.EventSignatureHeader)
+	s := ctx.GetHeader(notifier.WebhookSignatureHeader)
 	o.logger.Debugf("Event Type: %s, Event Sign: %s, Event Payload: %s\n", t, s, string(payload))
-	code, err := o.SignatureVerifier.VerifySignature(s)
+	code, err := o.SignatureVerifier.VerifySignature(ctx.Request, payload)
 	if err != nil {
 		_ = ctx.AbortWithError(code, err)
 		return
 	}
 
+	// answer the challenge of verification
+	if t == events.VerificationEventType {
+		v := events.VerificationPayload{}
+		if err := json.Unmarshal(payload, &v); err != nil {
+			_ = ctx.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, events.VerificationReply{Response: v.Token})
+		return
+	}
+
 	err = o.EventProcessor.ProcessWebhookEvent(t, payload)
 	if err != nil {
 		_ = ctx.AbortWithError(http.StatusBadRequest, err)
@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clients
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultNonceCacheSize = 10000
+)
+
+// NonceCache remembers nonces of received messages to reject replays.
+type NonceCache interface {
+	// Add returns false if the nonce is not expired yet.
+	Add(nonce string, expire time.Time) bool
+}
+
+type nonceEntry struct {
+	nonce  string
+	expire time.Time
+}
+
+// lruNonceCache is an in-memory NonceCache, the least recently added nonce is evicted when it is full.
+type lruNonceCache struct {
+	locker   sync.Mutex
+	capacity int
+	entries  *list.List
+	index    map[string]*list.Element
+}
+
+// NewLruNonceCache creates a NonceCache holding at most capacity nonces, capacity <= 0 means DefaultNonceCacheSize.
+func NewLruNonceCache(capacity int) *lruNonceCache {
+	if capacity <= 0 {
+		capacity = DefaultNonceCacheSize
+	}
+	return &lruNonceCache{
+		capacity: capacity,
+		entries:  list.New(),
+		index:    map[string]*list.Element{},
+	}
+}
+
+func (c *lruNonceCache) Add(nonce string, expire time.Time) bool {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	now := time.Now()
+	if e, ok := c.index[nonce]; ok {
+		if now.Before(e.Value.(*nonceEntry).expire) {
+			return false
+		}
+		c.entries.Remove(e)
+		delete(c.index, nonce)
+	}
+	for c.entries.Len() >= c.capacity {
+		e := c.entries.Back()
+		c.entries.Remove(e)
+		delete(c.index, e.Value.(*nonceEntry).nonce)
+	}
+	c.index[nonce] = c.entries.PushFront(&nonceEntry{
+		nonce:  nonce,
+		expire: expire,
+	})
+	return true
+}
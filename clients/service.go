@@ -20,10 +20,15 @@ package clients
 import (
 	"context"
 	"fmt"
+	"github.com/xfali/neve-webhook/auth"
+	"github.com/xfali/neve-webhook/deadletter"
+	"github.com/xfali/neve-webhook/deliverylog"
+	"github.com/xfali/neve-webhook/events"
 	"github.com/xfali/neve-webhook/recorder"
 	"github.com/xfali/neve-webhook/service"
 	"github.com/xfali/restclient/v2"
 	"github.com/xfali/restclient/v2/request"
+	"time"
 )
 
 type webHooksClient struct {
@@ -45,8 +50,8 @@ func NewWebHookClient(endpoint string, client restclient.RestClient) *webHooksCl
 	return ret
 }
 
-func (s *webHooksClient) Create(ctx context.Context, rec recorder.Input) (string, error) {
-	ret := Result[string]{}
+func (s *webHooksClient) Create(ctx context.Context, rec recorder.Input) (service.WebhookCreated, error) {
+	ret := Result[service.WebhookCreated]{}
 	url := s.endpoint
 	if s.CreatePath != "" {
 		url = s.CreatePath
@@ -84,12 +89,12 @@ func (s *webHooksClient) Get(ctx context.Context, cond recorder.QueryCondition)
 	return ret.Data, err
 }
 
-func (s *webHooksClient) Detail(ctx context.Context, id string) (recorder.Data, error) {
+func (s *webHooksClient) Detail(ctx context.Context, id string) (service.WebhookDetail, error) {
 	url := s.endpoint + "/" + id
 	if s.DetailPath != "" {
 		url = s.DetailPath
 	}
-	ret := Result[recorder.Data]{}
+	ret := Result[service.WebhookDetail]{}
 	err := s.client.Exchange(url,
 		request.WithRequestContext(ctx),
 		request.MethodGet(),
@@ -108,8 +113,138 @@ func (s *webHooksClient) Delete(ctx context.Context, id string) error {
 	return err
 }
 
+func (s *webHooksClient) ListDeadLetters(ctx context.Context, cond deadletter.QueryCondition) (service.DeadLetterList, error) {
+	url := fmt.Sprintf("%s/%s/deadletters?event_type=%s&current_page=%d&page_size=%d",
+		s.endpoint, cond.WebhookID, cond.EventType, cond.Offset, cond.PageSize)
+	ret := Result[service.DeadLetterList]{}
+	err := s.client.Exchange(url,
+		request.WithRequestContext(ctx),
+		request.MethodGet(),
+		request.WithResult(&ret))
+	return ret.Data, err
+}
+
+func (s *webHooksClient) DeadLetter(ctx context.Context, id string, letterId string) (deadletter.Letter, error) {
+	url := s.endpoint + "/" + id + "/deadletters/" + letterId
+	ret := Result[deadletter.Letter]{}
+	err := s.client.Exchange(url,
+		request.WithRequestContext(ctx),
+		request.MethodGet(),
+		request.WithResult(&ret))
+	return ret.Data, err
+}
+
+func (s *webHooksClient) ReplayDeadLetter(ctx context.Context, id string, letterId string) error {
+	url := s.endpoint + "/" + id + "/deadletters/" + letterId + "/replay"
+	err := s.client.Exchange(url,
+		request.WithRequestContext(ctx),
+		request.MethodPost())
+	return err
+}
+
+func (s *webHooksClient) PurgeDeadLetters(ctx context.Context, id string) error {
+	url := s.endpoint + "/" + id + "/deadletters"
+	err := s.client.Exchange(url,
+		request.WithRequestContext(ctx),
+		request.MethodDelete())
+	return err
+}
+
+func (s *webHooksClient) Deliveries(ctx context.Context, cond deliverylog.QueryCondition) (service.DeliveryList, error) {
+	url := fmt.Sprintf("%s/%s/deliveries?event_type=%s&current_page=%d&page_size=%d",
+		s.endpoint, cond.WebhookID, cond.EventType, cond.Offset, cond.PageSize)
+	ret := Result[service.DeliveryList]{}
+	err := s.client.Exchange(url,
+		request.WithRequestContext(ctx),
+		request.MethodGet(),
+		request.WithResult(&ret))
+	return ret.Data, err
+}
+
+func (s *webHooksClient) Delivery(ctx context.Context, id string, deliveryId string) (deliverylog.Delivery, error) {
+	url := s.endpoint + "/" + id + "/deliveries/" + deliveryId
+	ret := Result[deliverylog.Delivery]{}
+	err := s.client.Exchange(url,
+		request.WithRequestContext(ctx),
+		request.MethodGet(),
+		request.WithResult(&ret))
+	return ret.Data, err
+}
+
+func (s *webHooksClient) Redeliver(ctx context.Context, id string, deliveryId string) (service.SendResult, error) {
+	url := s.endpoint + "/" + id + "/deliveries/" + deliveryId + "/redeliver"
+	ret := Result[service.SendResult]{}
+	err := s.client.Exchange(url,
+		request.WithRequestContext(ctx),
+		request.MethodPost(),
+		request.WithResult(&ret))
+	return ret.Data, err
+}
+
+func (s *webHooksClient) Ping(ctx context.Context, id string) (service.SendResult, error) {
+	url := s.endpoint + "/" + id + "/ping"
+	ret := Result[service.SendResult]{}
+	err := s.client.Exchange(url,
+		request.WithRequestContext(ctx),
+		request.MethodPost(),
+		request.WithResult(&ret))
+	return ret.Data, err
+}
+
+func (s *webHooksClient) Challenge(ctx context.Context, id string) (service.SendResult, error) {
+	url := s.endpoint + "/" + id + "/verify/challenge"
+	ret := Result[service.SendResult]{}
+	err := s.client.Exchange(url,
+		request.WithRequestContext(ctx),
+		request.MethodPost(),
+		request.WithResult(&ret))
+	return ret.Data, err
+}
+
+func (s *webHooksClient) Verify(ctx context.Context, id string, token string) error {
+	url := s.endpoint + "/" + id + "/verify"
+	err := s.client.Exchange(url,
+		request.WithRequestContext(ctx),
+		request.MethodPost(),
+		request.WithRequestBody(events.VerificationReply{Response: token}))
+	return err
+}
+
 type Result[T any] struct {
 	Code int64  `json:"code"`
 	Msg  string `json:"message"`
 	Data T      `json:"data,omitempty"`
 }
+
+func (s *webHooksClient) RotateSecret(ctx context.Context, id string, grace time.Duration) (service.SecretRotation, error) {
+	url := s.endpoint + "/" + id + "/secret/rotate"
+	if grace > 0 {
+		url = fmt.Sprintf("%s?grace=%d", url, int64(grace/time.Second))
+	}
+	ret := Result[service.SecretRotation]{}
+	err := s.client.Exchange(url,
+		request.WithRequestContext(ctx),
+		request.MethodPost(),
+		request.WithResult(&ret))
+	return ret.Data, err
+}
+
+func (s *webHooksClient) RevealSecret(ctx context.Context, id string) (service.SecretReveal, error) {
+	url := s.endpoint + "/" + id + "/secret/reveal"
+	ret := Result[service.SecretReveal]{}
+	err := s.client.Exchange(url,
+		request.WithRequestContext(ctx),
+		request.MethodPost(),
+		request.WithResult(&ret))
+	return ret.Data, err
+}
+
+func (s *webHooksClient) JWKS(ctx context.Context) (auth.JWKSet, error) {
+	url := s.endpoint + "/.well-known/jwks.json"
+	ret := auth.JWKSet{}
+	err := s.client.Exchange(url,
+		request.WithRequestContext(ctx),
+		request.MethodGet(),
+		request.WithResult(&ret))
+	return ret, err
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clients
+
+import (
+	"crypto/hmac"
+	"errors"
+	"github.com/xfali/neve-webhook/auth"
+	"github.com/xfali/neve-webhook/notifier"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTimestampTolerance = 5 * time.Minute
+)
+
+var (
+	MissingSignatureErr = errors.New("Missing signature headers ")
+	InvalidTimestampErr = errors.New("Invalid timestamp ")
+	InvalidSignatureErr = errors.New("Invalid signature ")
+	ReplayedMessageErr  = errors.New("Replayed message ")
+)
+
+type VerifierOpt func(c *verifierConfig)
+
+type verifierConfig struct {
+	secrets   []string
+	tolerance time.Duration
+	nonces    NonceCache
+
+	client          *http.Client
+	refreshInterval time.Duration
+	jwksUrl         string
+}
+
+func newVerifierConfig(opts ...VerifierOpt) verifierConfig {
+	ret := verifierConfig{
+		tolerance:       DefaultTimestampTolerance,
+		nonces:          NewLruNonceCache(DefaultNonceCacheSize),
+		client:          &http.Client{Timeout: DefaultJwksFetchTimeout},
+		refreshInterval: DefaultJwksRefreshInterval,
+	}
+	for _, opt := range opts {
+		opt(&ret)
+	}
+	return ret
+}
+
+type signedMessage struct {
+	id         string
+	ts         string
+	timestamp  int64
+	signatures string
+}
+
+// parse reads headers of Standard Webhooks and checks the timestamp.
+func (c *verifierConfig) parse(req *http.Request, now time.Time) (*signedMessage, int, error) {
+	ret := &signedMessage{
+		id:         req.Header.Get(notifier.WebhookIDHeader),
+		ts:         req.Header.Get(notifier.WebhookTimestampHeader),
+		signatures: req.Header.Get(notifier.WebhookSignatureHeader),
+	}
+	if ret.id == "" || ret.ts == "" || ret.signatures == "" {
+		return nil, http.StatusBadRequest, MissingSignatureErr
+	}
+	var err error
+	ret.timestamp, err = strconv.ParseInt(ret.ts, 10, 64)
+	if err != nil {
+		return nil, http.StatusBadRequest, InvalidTimestampErr
+	}
+	if math.Abs(float64(now.Unix()-ret.timestamp)) > c.tolerance.Seconds() {
+		return nil, http.StatusUnauthorized, InvalidTimestampErr
+	}
+	return ret, http.StatusOK, nil
+}
+
+// checkReplay must be called after the signature is verified.
+func (c *verifierConfig) checkReplay(m *signedMessage, now time.Time) (int, error) {
+	// retries of a message share the id but are signed with new timestamps
+	if c.nonces != nil && !c.nonces.Add(m.id+"."+m.ts, now.Add(2*c.tolerance)) {
+		return http.StatusUnauthorized, ReplayedMessageErr
+	}
+	return http.StatusOK, nil
+}
+
+// standardVerifier verifies HMAC signatures of Standard Webhooks with timestamp tolerance and replay protection.
+type standardVerifier struct {
+	verifierConfig
+}
+
+func NewStandardVerifier(secret string, opts ...VerifierOpt) *standardVerifier {
+	ret := &standardVerifier{
+		verifierConfig: newVerifierConfig(opts...),
+	}
+	ret.secrets = append([]string{secret}, ret.secrets...)
+	return ret
+}
+
+func (v *standardVerifier) VerifySignature(req *http.Request, body []byte) (int, error) {
+	now := time.Now()
+	m, code, err := v.parse(req, now)
+	if err != nil {
+		return code, err
+	}
+	matched := false
+	for _, secret := range v.secrets {
+		expect, err := auth.StandardSignature(secret, m.id, m.timestamp, body)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if MatchSignature(m.signatures, expect) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return http.StatusUnauthorized, InvalidSignatureErr
+	}
+	return v.checkReplay(m, now)
+}
+
+// MatchSignature returns true if any of the space separated versioned signatures equals to expect.
+func MatchSignature(signatures, expect string) bool {
+	for _, s := range strings.Fields(signatures) {
+		if hmac.Equal([]byte(s), []byte(expect)) {
+			return true
+		}
+	}
+	return false
+}
+
+type verifierOpts struct{}
+
+var VerifierOpts verifierOpts
+
+// SetTolerance sets the max difference between the timestamp of message and now.
+// Non-positive tolerance is ignored, the timestamp bounds how long received messages are remembered against replay.
+func (o verifierOpts) SetTolerance(t time.Duration) VerifierOpt {
+	return func(c *verifierConfig) {
+		if t > 0 {
+			c.tolerance = t
+		}
+	}
+}
+
+// AddSecret adds a secret accepted as well, e.g. the new one while the secret is rotating.
+func (o verifierOpts) AddSecret(secret string) VerifierOpt {
+	return func(c *verifierConfig) {
+		c.secrets = append(c.secrets, secret)
+	}
+}
+
+// SetNonceCache sets the cache of received message, nil to disable replay protection.
+func (o verifierOpts) SetNonceCache(nc NonceCache) VerifierOpt {
+	return func(c *verifierConfig) {
+		c.nonces = nc
+	}
+}
+
+// SetHttpClient sets the client fetching JWKS.
+func (o verifierOpts) SetHttpClient(client *http.Client) VerifierOpt {
+	return func(c *verifierConfig) {
+		c.client = client
+	}
+}
+
+// SetJwksUrl sets the JWKS url of the server, to verify Ed25519 signatures of RFC 9421.
+func (o verifierOpts) SetJwksUrl(url string) VerifierOpt {
+	return func(c *verifierConfig) {
+		c.jwksUrl = url
+	}
+}
+
+// SetRefreshInterval sets the interval of fetching JWKS.
+func (o verifierOpts) SetRefreshInterval(t time.Duration) VerifierOpt {
+	return func(c *verifierConfig) {
+		c.refreshInterval = t
+	}
+}
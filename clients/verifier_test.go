@@ -0,0 +1,242 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clients
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/xfali/neve-webhook/auth"
+	"github.com/xfali/neve-webhook/notifier"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func signedRequest(t *testing.T, secret, msgId string, ts time.Time, body string) *http.Request {
+	sig, err := auth.StandardSignature(secret, msgId, ts.Unix(), []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body))
+	req.Header.Set(notifier.WebhookIDHeader, msgId)
+	req.Header.Set(notifier.WebhookTimestampHeader, strconv.FormatInt(ts.Unix(), 10))
+	req.Header.Set(notifier.WebhookSignatureHeader, "v1,invalid "+sig)
+	return req
+}
+
+func TestStandardVerifier(t *testing.T) {
+	v := NewStandardVerifier("test-secret")
+	body := `{"test":1}`
+
+	req := signedRequest(t, "test-secret", "1", time.Now(), body)
+	if _, err := v.VerifySignature(req, []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.VerifySignature(req, []byte(body)); err != ReplayedMessageErr {
+		t.Fatalf("Expect replayed but get %v\n", err)
+	}
+	if _, err := v.VerifySignature(req, []byte(`{"test":2}`)); err != InvalidSignatureErr {
+		t.Fatalf("Expect invalid signature but get %v\n", err)
+	}
+
+	req = signedRequest(t, "other-secret", "2", time.Now(), body)
+	if _, err := v.VerifySignature(req, []byte(body)); err != InvalidSignatureErr {
+		t.Fatalf("Expect invalid signature but get %v\n", err)
+	}
+	// rotating
+	v2 := NewStandardVerifier("test-secret", VerifierOpts.AddSecret("other-secret"))
+	if _, err := v2.VerifySignature(req, []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	req = signedRequest(t, "test-secret", "3", time.Now().Add(-time.Hour), body)
+	if _, err := v.VerifySignature(req, []byte(body)); err != InvalidTimestampErr {
+		t.Fatalf("Expect invalid timestamp but get %v\n", err)
+	}
+	// replay protection is kept with non-positive tolerance
+	v3 := NewStandardVerifier("test-secret", VerifierOpts.SetTolerance(0))
+	if _, err := v3.VerifySignature(req, []byte(body)); err != InvalidTimestampErr {
+		t.Fatalf("Expect invalid timestamp but get %v\n", err)
+	}
+	req = signedRequest(t, "test-secret", "4", time.Now(), body)
+	if _, err := v3.VerifySignature(req, []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v3.VerifySignature(req, []byte(body)); err != ReplayedMessageErr {
+		t.Fatalf("Expect replayed but get %v\n", err)
+	}
+}
+
+func TestLruNonceCache(t *testing.T) {
+	c := NewLruNonceCache(2)
+	expire := time.Now().Add(time.Minute)
+	if !c.Add("1", expire) || !c.Add("2", expire) {
+		t.Fatal("Expect added")
+	}
+	if c.Add("1", expire) {
+		t.Fatal("Expect duplicated")
+	}
+	c.Add("3", expire)
+	if !c.Add("1", expire) {
+		t.Fatal("Expect evicted")
+	}
+}
+
+func TestJwksVerifier(t *testing.T) {
+	keyring := auth.NewEd25519Keyring()
+	if err := keyring.Generate("k1"); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(keyring.JWKS())
+	}))
+	defer server.Close()
+
+	signer := auth.NewEd25519Signer(keyring)
+	body := `{"test":1}`
+	now := time.Now()
+	header, err := signer.Sign(nil, auth.SignMeta{MsgID: "1", Timestamp: now}, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body))
+	req.Header = header
+	req.Header.Set(notifier.WebhookIDHeader, "1")
+	req.Header.Set(notifier.WebhookTimestampHeader, strconv.FormatInt(now.Unix(), 10))
+
+	v := NewJwksVerifier(server.URL)
+	if _, err := v.VerifySignature(req, []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.VerifySignature(req, []byte(`{"test":2}`)); err != InvalidSignatureErr {
+		t.Fatalf("Expect invalid signature but get %v\n", err)
+	}
+}
+
+func TestJwksVerifierRevokedKey(t *testing.T) {
+	keyring := auth.NewEd25519Keyring()
+	if err := keyring.Generate("k1"); err != nil {
+		t.Fatal(err)
+	}
+	var available int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&available) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(keyring.JWKS())
+	}))
+	defer server.Close()
+
+	v := NewJwksVerifier(server.URL, VerifierOpts.SetRefreshInterval(time.Minute))
+	now := time.Now()
+	if _, err := v.key("k1", now); err != nil {
+		t.Fatal(err)
+	}
+	// the cached key is kept if the JWKS is unavailable
+	atomic.StoreInt32(&available, 0)
+	now = now.Add(2 * time.Minute)
+	if _, err := v.key("k1", now); err != nil {
+		t.Fatal(err)
+	}
+	// the key is rejected after it is removed from the JWKS
+	atomic.StoreInt32(&available, 1)
+	if err := keyring.Generate("k2"); err != nil {
+		t.Fatal(err)
+	}
+	keyring.Remove("k1")
+	now = now.Add(2 * time.Minute)
+	if _, err := v.key("k1", now); err == nil {
+		t.Fatal("Expect removed key rejected")
+	}
+	if _, err := v.key("k2", now); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJwksVerifierSingleFetch(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	v := NewJwksVerifier(server.URL)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := v.key("k1", time.Now()); err == nil {
+				t.Error("Expect error")
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err := v.key("k1", time.Now()); err == nil {
+		t.Fatal("Expect error")
+	}
+	if c := atomic.LoadInt32(&count); c != 1 {
+		t.Fatalf("Expect 1 fetch but get %d\n", c)
+	}
+}
+
+func TestHttpSigVerifier(t *testing.T) {
+	secret := "whsec_" + base64.StdEncoding.EncodeToString([]byte("test-secret"))
+	body := `{"test":1}`
+	header, err := auth.NewHttpSigSigner(nil).Sign([]string{secret}, auth.SignMeta{
+		WebhookID: "1",
+		EventType: "push",
+		Timestamp: time.Now(),
+		Method:    http.MethodPost,
+		Url:       "http://example.com/events",
+	}, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.Header.Set(notifier.EventTypeHeader, "push")
+		return req
+	}
+
+	v := NewHttpSigVerifier(secret)
+	if _, err := v.VerifySignature(newRequest(), []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.VerifySignature(newRequest(), []byte(body)); err != ReplayedMessageErr {
+		t.Fatalf("Expect replayed but get %v\n", err)
+	}
+	if _, err := v.VerifySignature(newRequest(), []byte(`{"test":2}`)); err != InvalidDigestErr {
+		t.Fatalf("Expect invalid digest but get %v\n", err)
+	}
+	req := newRequest()
+	req.Header.Set(notifier.EventTypeHeader, "delete")
+	if _, err := NewHttpSigVerifier(secret).VerifySignature(req, []byte(body)); err != InvalidSignatureErr {
+		t.Fatalf("Expect invalid signature but get %v\n", err)
+	}
+}
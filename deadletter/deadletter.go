@@ -0,0 +1,64 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deadletter
+
+import (
+	"context"
+	"time"
+)
+
+type Attempt struct {
+	Time  time.Time `json:"time" xml:"time" yaml:"time"`
+	Error string    `json:"error" xml:"error" yaml:"error"`
+}
+
+// Letter is a delivery which exhausted its retries.
+type Letter struct {
+	ID         string      `json:"id" xml:"id" yaml:"id"`
+	WebhookID  string      `json:"webhook_id" xml:"webhook_id" yaml:"webhook_id"`
+	Url        string      `json:"url" xml:"url" yaml:"url"`
+	EventType  string      `json:"event_type" xml:"event_type" yaml:"event_type"`
+	PayLoad    interface{} `json:"payload" xml:"payload" yaml:"payload"`
+	LastError  string      `json:"last_error" xml:"last_error" yaml:"last_error"`
+	Attempts   []Attempt   `json:"attempts" xml:"attempts" yaml:"attempts"`
+	CreateTime time.Time   `json:"create_time" xml:"create_time" yaml:"create_time"`
+}
+
+type QueryCondition struct {
+	WebhookID string
+	EventType string
+
+	// Current page, start with 0
+	Offset int64
+	// Page size, default 20
+	PageSize int64
+}
+
+type Store interface {
+	// Put saves the letter and returns its id.
+	Put(ctx context.Context, letter Letter) (string, error)
+
+	Get(ctx context.Context, id string) (Letter, error)
+
+	Query(ctx context.Context, condition QueryCondition) ([]Letter, int64, error)
+
+	Delete(ctx context.Context, id string) error
+
+	// Purge deletes all letters of the webhook, or all letters if webhookId is empty.
+	Purge(ctx context.Context, webhookId string) error
+}
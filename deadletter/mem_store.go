@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deadletter
+
+import (
+	"context"
+	"fmt"
+	"github.com/xfali/goutils/container/xmap"
+	"github.com/xfali/neve-webhook/recorder"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCapacity = 10000
+)
+
+type memStore struct {
+	locker      sync.RWMutex
+	idGenerator recorder.IdGenerator
+	capacity    int
+	letters     *xmap.LinkedMap
+}
+
+// NewMemStore creates a Store keeping at most capacity letters in memory, the oldest letters are dropped when full.
+func NewMemStore(capacity int) *memStore {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &memStore{
+		idGenerator: recorder.NewIdGenerator(),
+		capacity:    capacity,
+		letters:     xmap.NewLinkedMap(),
+	}
+}
+
+func (s *memStore) Put(ctx context.Context, letter Letter) (string, error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if letter.ID == "" {
+		letter.ID = strconv.FormatInt(s.idGenerator.Next(), 10)
+	}
+	if letter.CreateTime.IsZero() {
+		letter.CreateTime = time.Now()
+	}
+	s.letters.Put(letter.ID, &letter)
+	for s.letters.Size() > s.capacity {
+		var oldest interface{}
+		s.letters.Foreach(func(key interface{}, value interface{}) bool {
+			oldest = key
+			return false
+		})
+		s.letters.Delete(oldest)
+	}
+	return letter.ID, nil
+}
+
+func (s *memStore) Get(ctx context.Context, id string) (Letter, error) {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	if v, ok := s.letters.Get(id); ok {
+		return *v.(*Letter), nil
+	}
+	return Letter{}, fmt.Errorf("Dead letter %s not found ", id)
+}
+
+func (s *memStore) Query(ctx context.Context, condition QueryCondition) ([]Letter, int64, error) {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	if condition.PageSize == 0 {
+		condition.PageSize = 20
+	}
+	skip := condition.Offset * condition.PageSize
+	total := int64(0)
+	ret := make([]Letter, 0, condition.PageSize)
+	s.letters.Foreach(func(key interface{}, value interface{}) bool {
+		l := value.(*Letter)
+		if condition.WebhookID != "" && l.WebhookID != condition.WebhookID {
+			return true
+		}
+		if condition.EventType != "" && l.EventType != condition.EventType {
+			return true
+		}
+		if total >= skip && total-skip < condition.PageSize {
+			ret = append(ret, *l)
+		}
+		total++
+		return true
+	})
+	return ret, total, nil
+}
+
+func (s *memStore) Delete(ctx context.Context, id string) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.letters.Delete(id)
+	return nil
+}
+
+func (s *memStore) Purge(ctx context.Context, webhookId string) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if webhookId == "" {
+		s.letters = xmap.NewLinkedMap()
+		return nil
+	}
+	var ids []interface{}
+	s.letters.Foreach(func(key interface{}, value interface{}) bool {
+		if value.(*Letter).WebhookID == webhookId {
+			ids = append(ids, key)
+		}
+		return true
+	})
+	for _, id := range ids {
+		s.letters.Delete(id)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deliverylog
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+const (
+	// Max bytes of response body kept in an attempt.
+	MaxResponseBodySize = 4096
+)
+
+// Attempt is one sending of a delivery.
+type Attempt struct {
+	DeliveryID    string        `json:"delivery_id" xml:"delivery_id" yaml:"delivery_id"`
+	WebhookID     string        `json:"webhook_id" xml:"webhook_id" yaml:"webhook_id"`
+	Url           string        `json:"url" xml:"url" yaml:"url"`
+	EventType     string        `json:"event_type" xml:"event_type" yaml:"event_type"`
+	Attempt       int           `json:"attempt" xml:"attempt" yaml:"attempt"`
+	RequestHeader http.Header   `json:"request_header" xml:"-" yaml:"request_header"`
+	BodyDigest    string        `json:"body_digest" xml:"body_digest" yaml:"body_digest"`
+	StatusCode    int           `json:"status_code" xml:"status_code" yaml:"status_code"`
+	ResponseBody  string        `json:"response_body" xml:"response_body" yaml:"response_body"`
+	Latency       time.Duration `json:"latency" xml:"latency" yaml:"latency"`
+	Error         string        `json:"error" xml:"error" yaml:"error"`
+	Time          time.Time     `json:"time" xml:"time" yaml:"time"`
+}
+
+// Delivery is an event sent to one webhook, with all of its attempts.
+type Delivery struct {
+	ID          string    `json:"id" xml:"id" yaml:"id"`
+	WebhookID   string    `json:"webhook_id" xml:"webhook_id" yaml:"webhook_id"`
+	Url         string    `json:"url" xml:"url" yaml:"url"`
+	EventType   string    `json:"event_type" xml:"event_type" yaml:"event_type"`
+	ContentType string    `json:"content_type" xml:"content_type" yaml:"content_type"`
+	Body        string    `json:"body" xml:"body" yaml:"body"`
+	BodyDigest  string    `json:"body_digest" xml:"body_digest" yaml:"body_digest"`
+	CreateTime  time.Time `json:"create_time" xml:"create_time" yaml:"create_time"`
+	Attempts    []Attempt `json:"attempts" xml:"attempts" yaml:"attempts"`
+}
+
+type QueryCondition struct {
+	WebhookID  string
+	DeliveryID string
+	EventType  string
+
+	// Current page, start with 0
+	Offset int64
+	// Page size, default 20
+	PageSize int64
+}
+
+type Store interface {
+	// Save creates the delivery, attempts of the delivery are ignored.
+	Save(ctx context.Context, delivery Delivery) error
+
+	// AddAttempt appends the attempt to its delivery.
+	AddAttempt(ctx context.Context, attempt Attempt) error
+
+	// Get returns the delivery with its attempts.
+	Get(ctx context.Context, deliveryId string) (Delivery, error)
+
+	// QueryAttempts returns attempts matched the condition, newest first.
+	QueryAttempts(ctx context.Context, condition QueryCondition) ([]Attempt, int64, error)
+}
+
+// NewID generates a random delivery id.
+func NewID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Digest returns the sha256 digest of body.
+func Digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Truncate cuts body to MaxResponseBodySize.
+func Truncate(body []byte) string {
+	if len(body) > MaxResponseBodySize {
+		return string(body[:MaxResponseBodySize])
+	}
+	return string(body)
+}
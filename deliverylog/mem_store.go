@@ -0,0 +1,138 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deliverylog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+const (
+	DefaultCapacity = 10000
+)
+
+type memStore struct {
+	locker     sync.RWMutex
+	capacity   int
+	deliveries map[string]*Delivery
+	// Deliveries in creation order
+	order []string
+	// Attempts in creation order
+	attempts []*Attempt
+}
+
+// NewMemStore creates a Store keeping at most capacity deliveries in memory, the oldest deliveries are dropped when full.
+func NewMemStore(capacity int) *memStore {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &memStore{
+		capacity:   capacity,
+		deliveries: map[string]*Delivery{},
+	}
+}
+
+func (s *memStore) Save(ctx context.Context, delivery Delivery) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if delivery.ID == "" {
+		return fmt.Errorf("Delivery id cannot be empty ")
+	}
+	if _, ok := s.deliveries[delivery.ID]; ok {
+		return fmt.Errorf("Delivery %s have been exists ", delivery.ID)
+	}
+	delivery.Attempts = nil
+	s.deliveries[delivery.ID] = &delivery
+	s.order = append(s.order, delivery.ID)
+	if len(s.order) > s.capacity {
+		s.evict(len(s.order) - s.capacity*9/10)
+	}
+	return nil
+}
+
+func (s *memStore) AddAttempt(ctx context.Context, attempt Attempt) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	d, ok := s.deliveries[attempt.DeliveryID]
+	if !ok {
+		return fmt.Errorf("Delivery %s not found ", attempt.DeliveryID)
+	}
+	d.Attempts = append(d.Attempts, attempt)
+	s.attempts = append(s.attempts, &attempt)
+	return nil
+}
+
+func (s *memStore) Get(ctx context.Context, deliveryId string) (Delivery, error) {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	d, ok := s.deliveries[deliveryId]
+	if !ok {
+		return Delivery{}, fmt.Errorf("Delivery %s not found ", deliveryId)
+	}
+	ret := *d
+	ret.Attempts = append([]Attempt(nil), d.Attempts...)
+	return ret, nil
+}
+
+func (s *memStore) QueryAttempts(ctx context.Context, condition QueryCondition) ([]Attempt, int64, error) {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	if condition.PageSize == 0 {
+		condition.PageSize = 20
+	}
+	skip := condition.Offset * condition.PageSize
+	total := int64(0)
+	ret := make([]Attempt, 0, condition.PageSize)
+	for i := len(s.attempts) - 1; i >= 0; i-- {
+		a := s.attempts[i]
+		if condition.WebhookID != "" && a.WebhookID != condition.WebhookID {
+			continue
+		}
+		if condition.DeliveryID != "" && a.DeliveryID != condition.DeliveryID {
+			continue
+		}
+		if condition.EventType != "" && a.EventType != condition.EventType {
+			continue
+		}
+		if total >= skip && total-skip < condition.PageSize {
+			ret = append(ret, *a)
+		}
+		total++
+	}
+	return ret, total, nil
+}
+
+// evict drops the n oldest deliveries with their attempts.
+func (s *memStore) evict(n int) {
+	for _, id := range s.order[:n] {
+		delete(s.deliveries, id)
+	}
+	s.order = append([]string(nil), s.order[n:]...)
+	attempts := make([]*Attempt, 0, len(s.attempts))
+	for _, a := range s.attempts {
+		if _, ok := s.deliveries[a.DeliveryID]; ok {
+			attempts = append(attempts, a)
+		}
+	}
+	s.attempts = attempts
+}
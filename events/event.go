@@ -17,14 +17,33 @@
 
 package events
 
+import "time"
+
+const (
+	// PingEventType is the type of the synthetic event sent to check a webhook.
+	PingEventType = "ping"
+	// WebhookGoneEventType is the type of the internal event published when a webhook answered 410 Gone.
+	WebhookGoneEventType = "webhook.gone"
+	// VerificationEventType is the type of the challenge sent to a webhook pending verification.
+	VerificationEventType = "webhook.verification"
+)
+
 type IEvent interface {
 	GetType() string
 	GetPayLoad() interface{}
 }
 
+// TenantEvent is an event of a tenant, it is only sent to webhooks of the tenant.
+type TenantEvent interface {
+	IEvent
+	GetTenant() string
+}
+
 type Event struct {
 	Type    string
 	PayLoad interface{}
+	// Tenant of the event, empty means the event is not bound to a tenant.
+	Tenant string
 }
 
 func (e *Event) GetType() string {
@@ -34,3 +53,59 @@ func (e *Event) GetType() string {
 func (e *Event) GetPayLoad() interface{} {
 	return e.PayLoad
 }
+
+func (e *Event) GetTenant() string {
+	return e.Tenant
+}
+
+type tenantEvent struct {
+	IEvent
+	tenant string
+}
+
+func (e *tenantEvent) GetTenant() string {
+	return e.tenant
+}
+
+// WithTenant binds the event to the tenant.
+func WithTenant(event IEvent, tenant string) IEvent {
+	return &tenantEvent{
+		IEvent: event,
+		tenant: tenant,
+	}
+}
+
+// TenantOf returns the tenant of the event, empty if it is not bound to a tenant.
+func TenantOf(event IEvent) string {
+	if e, ok := event.(TenantEvent); ok {
+		return e.GetTenant()
+	}
+	return ""
+}
+
+type PingPayload struct {
+	WebhookID string    `json:"webhook_id" xml:"webhook_id" yaml:"webhook_id"`
+	Time      time.Time `json:"time" xml:"time" yaml:"time"`
+}
+
+type WebhookGonePayload struct {
+	WebhookID string `json:"webhook_id" xml:"webhook_id" yaml:"webhook_id"`
+	Url       string `json:"url" xml:"url" yaml:"url"`
+	Reason    string `json:"reason" xml:"reason" yaml:"reason"`
+	// True if the webhook is deleted, otherwise it is forbidden.
+	Deleted bool      `json:"deleted" xml:"deleted" yaml:"deleted"`
+	Time    time.Time `json:"time" xml:"time" yaml:"time"`
+}
+
+// VerificationPayload is the challenge, the receiver answers the token in the response body as VerificationReply,
+// or posts it to the verify route of the server later.
+type VerificationPayload struct {
+	WebhookID string    `json:"webhook_id" xml:"webhook_id" yaml:"webhook_id"`
+	Token     string    `json:"token" xml:"token" yaml:"token"`
+	Time      time.Time `json:"time" xml:"time" yaml:"time"`
+}
+
+// VerificationReply answers the token in a field the challenge does not have, so echoing the challenge is not verified.
+type VerificationReply struct {
+	Response string `json:"response" xml:"response" yaml:"response"`
+}
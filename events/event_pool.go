@@ -30,3 +30,8 @@ type Service interface {
 
 	Put(ctx context.Context, event IEvent) error
 }
+
+// Acknowledger is implemented by Services which need to know when an event returned by Get has been handled.
+type Acknowledger interface {
+	Ack(ctx context.Context, event IEvent) error
+}
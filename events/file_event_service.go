@@ -0,0 +1,528 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xfali/xlog"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultSegmentSize  = 64 * 1024 * 1024
+	DefaultSyncInterval = time.Second
+
+	segmentExt       = ".log"
+	recordHeaderSize = 8
+
+	recordOpPut = "put"
+	recordOpAck = "ack"
+)
+
+type SyncPolicy int
+
+const (
+	// Fsync after every record written.
+	SyncAlways SyncPolicy = iota
+	// Fsync periodically, see FileOpts.SetSyncInterval.
+	SyncInterval
+	// Leave flushing to the operating system.
+	SyncNever
+)
+
+var CorruptedRecordErr = errors.New("Log record corrupted ")
+
+type FileOpt func(s *fileEventService)
+
+type record struct {
+	Op      string          `json:"op"`
+	Seq     uint64          `json:"seq"`
+	Type    string          `json:"type,omitempty"`
+	PayLoad json.RawMessage `json:"payload,omitempty"`
+	Tenant  string          `json:"tenant,omitempty"`
+}
+
+type segment struct {
+	base    uint64
+	path    string
+	unacked int
+}
+
+type logEvent struct {
+	IEvent
+	seq uint64
+}
+
+func (e *logEvent) GetTenant() string {
+	return TenantOf(e.IEvent)
+}
+
+// fileEventService persists events in an append-only log of segment files.
+// Events returned by Get stay in the log until they are acknowledged by Ack, so that
+// pending events are delivered again after restart.
+// Segments which only contain acknowledged events are removed from the head of the log.
+type fileEventService struct {
+	logger   xlog.Logger
+	dir      string
+	registry *PayloadRegistry
+
+	segmentSize  int64
+	syncPolicy   SyncPolicy
+	syncInterval time.Duration
+
+	locker   sync.Mutex
+	segments []*segment
+	file     *os.File
+	fileSize int64
+	dirty    bool
+	nextSeq  uint64
+	pending  []*logEvent
+	unacked  map[uint64]*segment
+
+	signal   chan struct{}
+	stopChan chan struct{}
+}
+
+func NewFileEventService(dir string, opts ...FileOpt) *fileEventService {
+	ret := &fileEventService{
+		logger:       xlog.GetLogger(),
+		dir:          dir,
+		registry:     DefaultPayloadRegistry,
+		segmentSize:  DefaultSegmentSize,
+		syncPolicy:   SyncInterval,
+		syncInterval: DefaultSyncInterval,
+		signal:       make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+func (s *fileEventService) Connect() error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	if err := s.load(); err != nil {
+		return err
+	}
+	s.stopChan = make(chan struct{})
+	if s.syncPolicy == SyncInterval {
+		go s.syncLoop(s.stopChan)
+	}
+	if len(s.pending) > 0 {
+		s.wakeup()
+	}
+	return nil
+}
+
+func (s *fileEventService) Disconnect() error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	// not connected
+	if s.stopChan == nil {
+		return nil
+	}
+	select {
+	case <-s.stopChan:
+		return nil
+	default:
+		close(s.stopChan)
+	}
+	if s.file != nil {
+		err := s.file.Sync()
+		if err != nil {
+			s.logger.Warnln("Sync event log failed: ", err)
+		}
+		err = s.file.Close()
+		s.file = nil
+		return err
+	}
+	return nil
+}
+
+func (s *fileEventService) Get(ctx context.Context) (IEvent, error) {
+	for {
+		s.locker.Lock()
+		if len(s.pending) > 0 {
+			e := s.pending[0]
+			s.pending[0] = nil
+			s.pending = s.pending[1:]
+			if len(s.pending) > 0 {
+				s.wakeup()
+			}
+			s.locker.Unlock()
+			return e, nil
+		}
+		s.locker.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.stopChan:
+			return nil, DisconnectedErr
+		case <-s.signal:
+		}
+	}
+}
+
+func (s *fileEventService) Put(ctx context.Context, event IEvent) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.stopChan:
+		return DisconnectedErr
+	default:
+	}
+
+	data, err := json.Marshal(event.GetPayLoad())
+	if err != nil {
+		return err
+	}
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	seq := s.nextSeq
+	seg, err := s.append(&record{
+		Op:      recordOpPut,
+		Seq:     seq,
+		Type:    event.GetType(),
+		PayLoad: data,
+		Tenant:  TenantOf(event),
+	})
+	if err != nil {
+		return err
+	}
+	s.nextSeq++
+	seg.unacked++
+	s.unacked[seq] = seg
+	s.pending = append(s.pending, &logEvent{IEvent: event, seq: seq})
+	s.wakeup()
+	return nil
+}
+
+// Ack marks the event as handled. Acknowledged events will not be delivered after restart.
+func (s *fileEventService) Ack(ctx context.Context, event IEvent) error {
+	e, ok := event.(*logEvent)
+	if !ok {
+		return fmt.Errorf("Event %s is not taken from this service ", event.GetType())
+	}
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	seg, ok := s.unacked[e.seq]
+	if !ok {
+		return nil
+	}
+	if _, err := s.append(&record{Op: recordOpAck, Seq: e.seq}); err != nil {
+		return err
+	}
+	delete(s.unacked, e.seq)
+	seg.unacked--
+	s.compact()
+	return nil
+}
+
+func (s *fileEventService) wakeup() {
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (s *fileEventService) load() error {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*"+segmentExt))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	s.segments = nil
+	s.pending = nil
+	s.unacked = map[uint64]*segment{}
+	s.nextSeq = 1
+
+	type putRecord struct {
+		record
+		seg *segment
+	}
+	var puts []putRecord
+	acked := map[uint64]struct{}{}
+	for i, p := range paths {
+		base, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(p), segmentExt), 10, 64)
+		if err != nil {
+			s.logger.Warnln("Skip unknown file in event log: ", p)
+			continue
+		}
+		seg := &segment{base: base, path: p}
+		s.segments = append(s.segments, seg)
+		records, valid, err := readSegment(p)
+		if err != nil {
+			if err != CorruptedRecordErr {
+				return err
+			}
+			s.logger.Warnf("Event log segment %s corrupted at offset %d\n", p, valid)
+			if i == len(paths)-1 {
+				if err := os.Truncate(p, valid); err != nil {
+					return err
+				}
+			}
+		}
+		for _, r := range records {
+			if r.Seq >= s.nextSeq {
+				s.nextSeq = r.Seq + 1
+			}
+			switch r.Op {
+			case recordOpPut:
+				puts = append(puts, putRecord{record: r, seg: seg})
+			case recordOpAck:
+				acked[r.Seq] = struct{}{}
+			}
+		}
+	}
+
+	for _, r := range puts {
+		if _, ok := acked[r.Seq]; ok {
+			continue
+		}
+		payload, err := s.registry.Decode(r.Type, r.PayLoad)
+		if err != nil {
+			s.logger.Errorf("Decode payload of event %s failed: %v\n", r.Type, err)
+			payload = r.PayLoad
+		}
+		r.seg.unacked++
+		s.unacked[r.Seq] = r.seg
+		s.pending = append(s.pending, &logEvent{
+			IEvent: &Event{
+				Type:    r.Type,
+				PayLoad: payload,
+				Tenant:  r.Tenant,
+			},
+			seq: r.Seq,
+		})
+	}
+
+	if err := s.roll(); err != nil {
+		return err
+	}
+	s.compact()
+	return nil
+}
+
+func (s *fileEventService) append(r *record) (*segment, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, recordHeaderSize+len(data))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(data))
+	copy(buf[recordHeaderSize:], data)
+
+	if s.fileSize > 0 && s.fileSize+int64(len(buf)) > s.segmentSize {
+		if err := s.roll(); err != nil {
+			return nil, err
+		}
+	}
+	n, err := s.file.Write(buf)
+	s.fileSize += int64(n)
+	if err != nil {
+		return nil, err
+	}
+	if s.syncPolicy == SyncAlways {
+		if err := s.file.Sync(); err != nil {
+			return nil, err
+		}
+	} else {
+		s.dirty = true
+	}
+	return s.segments[len(s.segments)-1], nil
+}
+
+// roll closes the active segment and opens a new one.
+// An empty last segment is reused.
+func (s *fileEventService) roll() error {
+	if len(s.segments) > 0 && s.file == nil {
+		last := s.segments[len(s.segments)-1]
+		if fi, err := os.Stat(last.path); err == nil && fi.Size() == 0 {
+			f, err := os.OpenFile(last.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				return err
+			}
+			s.file = f
+			s.fileSize = 0
+			return nil
+		}
+	}
+
+	if s.file != nil {
+		if err := s.file.Sync(); err != nil {
+			return err
+		}
+		if err := s.file.Close(); err != nil {
+			return err
+		}
+		s.file = nil
+		s.dirty = false
+	}
+
+	base := s.nextSeq
+	if len(s.segments) > 0 {
+		if last := s.segments[len(s.segments)-1].base; base <= last {
+			base = last + 1
+		}
+	}
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", base, segmentExt))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.file = f
+	s.fileSize = 0
+	s.segments = append(s.segments, &segment{base: base, path: path})
+	return nil
+}
+
+// compact removes fully acknowledged segments from the head of the log, the active segment is always kept.
+// Segments must be removed in order: ack records always follow the events they acknowledge.
+func (s *fileEventService) compact() {
+	for len(s.segments) > 1 && s.segments[0].unacked == 0 {
+		seg := s.segments[0]
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			s.logger.Warnln("Remove event log segment failed: ", err)
+			return
+		}
+		s.segments[0] = nil
+		s.segments = s.segments[1:]
+	}
+}
+
+func (s *fileEventService) syncLoop(stopChan chan struct{}) {
+	ticker := time.NewTicker(s.syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+			s.locker.Lock()
+			if s.dirty && s.file != nil {
+				if err := s.file.Sync(); err != nil {
+					s.logger.Warnln("Sync event log failed: ", err)
+				} else {
+					s.dirty = false
+				}
+			}
+			s.locker.Unlock()
+		}
+	}
+}
+
+// readSegment returns the records of the segment and the size of the valid part of the file.
+func readSegment(path string) ([]record, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var ret []record
+	var offset int64
+	r := bufio.NewReader(f)
+	header := make([]byte, recordHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return ret, offset, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				return ret, offset, CorruptedRecordErr
+			}
+			return nil, offset, err
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		if offset+recordHeaderSize+size > fi.Size() {
+			return ret, offset, CorruptedRecordErr
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return ret, offset, CorruptedRecordErr
+		}
+		if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:8]) {
+			return ret, offset, CorruptedRecordErr
+		}
+		rec := record{}
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return ret, offset, CorruptedRecordErr
+		}
+		ret = append(ret, rec)
+		offset += recordHeaderSize + size
+	}
+}
+
+type fileOpts struct{}
+
+var FileOpts fileOpts
+
+// SetSegmentSize sets the max size of a segment file in bytes.
+func (o fileOpts) SetSegmentSize(size int64) FileOpt {
+	return func(s *fileEventService) {
+		s.segmentSize = size
+	}
+}
+
+func (o fileOpts) SetSyncPolicy(p SyncPolicy) FileOpt {
+	return func(s *fileEventService) {
+		s.syncPolicy = p
+	}
+}
+
+func (o fileOpts) SetSyncInterval(t time.Duration) FileOpt {
+	return func(s *fileEventService) {
+		s.syncInterval = t
+	}
+}
+
+func (o fileOpts) SetPayloadRegistry(r *PayloadRegistry) FileOpt {
+	return func(s *fileEventService) {
+		s.registry = r
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package events
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testPayload struct {
+	Name  string
+	Value int
+}
+
+func TestFileEventService(t *testing.T) {
+	dir := t.TempDir()
+	registry := NewPayloadRegistry()
+	registry.Register("push", &testPayload{})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s := NewFileEventService(dir, FileOpts.SetPayloadRegistry(registry), FileOpts.SetSyncPolicy(SyncAlways))
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		err := s.Put(ctx, WithTenant(&Event{Type: "push", PayLoad: &testPayload{Name: "test", Value: i}}, "tenant1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	e, err := s.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Ack(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	// taken but not acknowledged
+	if _, err := s.Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = NewFileEventService(dir, FileOpts.SetPayloadRegistry(registry))
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Disconnect()
+	for i := 1; i < 3; i++ {
+		e, err := s.Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, ok := e.GetPayLoad().(*testPayload)
+		if !ok {
+			t.Fatalf("Expect *testPayload but get %T\n", e.GetPayLoad())
+		}
+		if p.Value != i {
+			t.Fatalf("Expect %d but get %d\n", i, p.Value)
+		}
+		if TenantOf(e) != "tenant1" {
+			t.Fatalf("Expect tenant1 but get %s\n", TenantOf(e))
+		}
+	}
+}
+
+func TestFileEventServiceCompact(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s := NewFileEventService(dir, FileOpts.SetSegmentSize(128), FileOpts.SetSyncPolicy(SyncNever))
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Disconnect()
+	for i := 0; i < 20; i++ {
+		err := s.Put(ctx, &Event{Type: "push", PayLoad: "This is a test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(files) < 2 {
+		t.Fatalf("Expect more than 1 segment but get %d\n", len(files))
+	}
+	for i := 0; i < 20; i++ {
+		e, err := s.Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Ack(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, _ = filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(files) != 1 {
+		t.Fatalf("Expect 1 segment but get %d\n", len(files))
+	}
+}
+
+func TestFileEventServiceDisconnect(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFileEventService(dir)
+	if err := s.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+
+	// dir cannot be created under a file
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s = NewFileEventService(filepath.Join(file, "events"))
+	if err := s.Connect(); err == nil {
+		t.Fatal("Expect connect failed")
+	}
+	if err := s.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+}
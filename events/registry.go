@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+// PayloadRegistry maps event types to payload types so that persisted payloads can be re-hydrated.
+type PayloadRegistry struct {
+	locker sync.RWMutex
+	types  map[string]reflect.Type
+}
+
+var DefaultPayloadRegistry = NewPayloadRegistry()
+
+func NewPayloadRegistry() *PayloadRegistry {
+	return &PayloadRegistry{
+		types: map[string]reflect.Type{},
+	}
+}
+
+// RegisterPayloadType registers the payload type of eventType to DefaultPayloadRegistry.
+func RegisterPayloadType(eventType string, payload interface{}) {
+	DefaultPayloadRegistry.Register(eventType, payload)
+}
+
+// Register binds eventType to the type of payload.
+// If payload is a pointer, the decoded payload is a pointer too.
+func (r *PayloadRegistry) Register(eventType string, payload interface{}) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	r.types[eventType] = reflect.TypeOf(payload)
+}
+
+func (r *PayloadRegistry) Unregister(eventType string) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	delete(r.types, eventType)
+}
+
+// Decode decodes data to the payload type registered with eventType.
+// Payloads of unregistered event types are returned as json.RawMessage.
+func (r *PayloadRegistry) Decode(eventType string, data []byte) (interface{}, error) {
+	r.locker.RLock()
+	t, ok := r.types[eventType]
+	r.locker.RUnlock()
+
+	if !ok || t == nil {
+		return json.RawMessage(data), nil
+	}
+	if t.Kind() == reflect.Ptr {
+		v := reflect.New(t.Elem())
+		if err := json.Unmarshal(data, v.Interface()); err != nil {
+			return nil, err
+		}
+		return v.Interface(), nil
+	}
+	v := reflect.New(t)
+	if err := json.Unmarshal(data, v.Interface()); err != nil {
+		return nil, err
+	}
+	return v.Elem().Interface(), nil
+}
@@ -41,7 +41,7 @@ func NewTestHandler() *TestHandler {
 }
 
 func (o *TestHandler) BeanAfterSet() error {
-	id, err := o.Cli.Create(context.Background(), recorder.Data{
+	v, err := o.Cli.Create(context.Background(), recorder.Input{
 		Url:    "http://localhost:8081/events",
 		Secret: "just-test",
 		TriggerEventTypes: []string{
@@ -51,7 +51,7 @@ func (o *TestHandler) BeanAfterSet() error {
 	if err != nil {
 		return err
 	}
-	o.id = id
+	o.id = v.ID
 	return nil
 }
 
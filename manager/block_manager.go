@@ -19,12 +19,13 @@ package manager
 
 import (
 	"context"
-	"github.com/xfali/neve-webhook/errors"
+	"github.com/xfali/neve-webhook/auth"
+	"github.com/xfali/neve-webhook/deadletter"
+	"github.com/xfali/neve-webhook/deliverylog"
 	"github.com/xfali/neve-webhook/events"
 	"github.com/xfali/neve-webhook/notifier"
 	"github.com/xfali/neve-webhook/recorder"
 	"github.com/xfali/neve-webhook/serialize"
-	"github.com/xfali/xlog"
 	"time"
 )
 
@@ -36,31 +37,30 @@ const (
 type BlockOpt func(m *blockManager)
 
 type blockManager struct {
-	logger xlog.Logger
+	sender
 
-	recorder recorder.Recorder
-	notifier notifier.Notifier
+	pool *workerPool
+
+	workers   int
+	perHook   int
+	perHost   int
+	queueSize int
 
 	ctx    context.Context
 	cancel context.CancelFunc
-
-	signFunc      SignatureFunc
-	notifyTimeout time.Duration
-	retryCount    int
 }
 
 func NewBlockManager(recorder recorder.Recorder, opts ...BlockOpt) *blockManager {
 	ret := &blockManager{
-		logger:        xlog.GetLogger(),
-		recorder:      recorder,
-		notifier:      notifier.NewHttpNotifier(nil),
-		signFunc:      defaultSignFunc,
-		notifyTimeout: NotifyTimeout,
-		retryCount:    DefaultRetryCount,
+		sender:  newSender(recorder),
+		workers: DefaultWorkers,
+		perHook: DefaultWebhookConcurrency,
+		perHost: DefaultHostConcurrency,
 	}
 	for _, opt := range opts {
 		opt(ret)
 	}
+	ret.pool = newWorkerPool(ret.workers, ret.perHook, ret.perHost, ret.queueSize, ret.limiters)
 	return ret
 }
 
@@ -74,19 +74,48 @@ func (m *blockManager) BeanDestroy() error {
 
 func (m *blockManager) Start() error {
 	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.scheduler.Start()
+	m.pool.Start()
 	return nil
 }
 
 func (m *blockManager) Close() error {
 	m.cancel()
+	m.scheduler.Stop()
+	m.pool.Stop()
 
 	return nil
 }
 
+// RateLimiterState returns the rate limiter state of the webhook, nil if it has no rate limit.
+func (m *blockManager) RateLimiterState(ctx context.Context, data recorder.Data) *RateLimiterState {
+	key := ctxHookKey(ctx, data.ID)
+	ret := m.limiters.state(key, data)
+	if ret != nil {
+		ret.Queued = m.pool.Pending(key)
+	}
+	return ret
+}
+
+// QueueDepth returns the number of deliveries waiting for a worker.
+func (m *blockManager) QueueDepth() int {
+	return m.pool.Len()
+}
+
 func (m *blockManager) Notify(ctx context.Context, event events.IEvent, ds serialize.Deserializer) (<-chan *notifier.Response, error) {
+	r, err := m.Dispatch(ctx, event, ds)
+	if err != nil {
+		return nil, err
+	}
+	return r.Responses(), nil
+}
+
+// Dispatch notifies the event to all matching webhooks, outcomes can be waited by the returned NotifyResult.
+// The result of deliveries already submitted is returned with the error if it failed part way.
+func (m *blockManager) Dispatch(ctx context.Context, event events.IEvent, ds serialize.Deserializer) (*NotifyResult, error) {
+	ctx = tenantContext(ctx, event)
 	offset := int64(0)
-	respChan := make(chan *notifier.Response, ResponseChanBufferSize)
-	errList := &errors.LockedErrList{}
+	r := newNotifyResult(ctx)
 	for {
 		datas, _, err := m.recorder.Query(ctx, recorder.QueryCondition{
 			EventType: event.GetType(),
@@ -95,79 +124,77 @@ func (m *blockManager) Notify(ctx context.Context, event events.IEvent, ds seria
 			PageSize:  ResponseChanBufferSize,
 		})
 		if err != nil {
-			return nil, err
+			r.seal()
+			return r, err
 		}
 		if len(datas) == 0 {
 			break
 		}
 		offset++
 		for _, d := range datas {
-			go m.notify(ctx, d, event, ds, respChan, errList)
+			dl := newDelivery(ctx, d, event)
+			r.expect()
+			err = m.pool.Submit(&poolTask{
+				webhookID: dl.hookKey(),
+				host:      hostOf(d.Url),
+				rate:      d.RateLimit,
+				burst:     d.RateBurst,
+				run: func() bool {
+					m.notify(ctx, dl, ds, r)
+					return false
+				},
+				drop: func() {
+					r.add(newResponse(dl, nil, PoolStoppedErr))
+				},
+			})
+			if err != nil {
+				r.add(newResponse(dl, nil, err))
+				r.seal()
+				return r, err
+			}
 		}
 	}
-	if errList.Empty() {
-		return respChan, nil
-	}
-	return respChan, errList
+	r.seal()
+	return r, nil
 }
 
-func (m *blockManager) notify(ctx context.Context, d recorder.Data, event events.IEvent, ds serialize.Deserializer, respChan chan *notifier.Response, errs errors.ErrorList) {
-	var resp *notifier.Response
-	holder := &resp
-	defer func(o **notifier.Response) {
-		select {
-		case <-ctx.Done():
-			err := ctx.Err()
-			if err != nil {
-				m.logger.Warnln(err)
-			}
-			return
-		case respChan <- *o:
-		}
-	}(holder)
-	now := time.Now()
-	secret, err := m.signFunc(d.Secret)
-	if err != nil {
-		m.logger.Errorln(err)
+func (m *blockManager) notify(ctx context.Context, dl *delivery, ds serialize.Deserializer, r *NotifyResult) {
+	if err := ctx.Err(); err != nil {
+		m.logger.Warnln(err)
+		r.add(newResponse(dl, nil, err))
 		return
 	}
-	nCtx, _ := context.WithTimeout(ctx, m.notifyTimeout)
-	for i := 0; i < m.retryCount; i++ {
-		data, err := m.notifier.Send(nCtx, d.Url, d.ContentType, secret, event)
-		if err != nil {
-			errs.Add(err)
-			m.logger.Errorln("Notifier send message failed: ", err)
-			*holder = &notifier.Response{
-				Url:     d.Url,
-				Payload: nil,
-				Error:   err,
-			}
-			err = m.recorder.UpdateNotifyStatus(ctx, d.ID, now, false)
-			if err != nil {
-				m.logger.Errorln("Recorder UpdateNotifyStatus failed: ", err)
-			}
-			continue
-		} else {
-			errU := m.recorder.UpdateNotifyStatus(ctx, d.ID, now, true)
-			if errU != nil {
-				m.logger.Errorln("Recorder UpdateNotifyStatus failed: ", errU)
-			}
-			var payload interface{}
-			if ds != nil {
-				payload, err = ds.Deserialize(data)
-				if err != nil {
-					errs.Add(err)
-					m.logger.Errorln("Deserialize hook response failed: ", err)
-				}
-			}
-			*holder = &notifier.Response{
-				Url:     d.Url,
-				Payload: payload,
-				Error:   err,
+	result, err := m.attempt(ctx, dl)
+	resp := newResponse(dl, result, err)
+	if err != nil {
+		drop := func() {
+			r.add(resp)
+		}
+		if m.retryOrBury(ctx, dl, err, func() {
+			errR := m.pool.Resubmit(&poolTask{
+				webhookID: dl.hookKey(),
+				host:      hostOf(dl.data.Url),
+				rate:      dl.data.RateLimit,
+				burst:     dl.data.RateBurst,
+				run: func() bool {
+					m.notify(ctx, dl, ds, r)
+					return false
+				},
+				drop: drop,
+			})
+			if errR != nil {
+				drop()
 			}
-			break
+		}, drop) {
+			return
+		}
+	} else if ds != nil {
+		resp.Payload, resp.Error = ds.Deserialize(result.Body)
+		if resp.Error != nil {
+			m.logger.Errorln("Deserialize hook response failed: ", resp.Error)
 		}
 	}
+	r.add(resp)
 }
 
 type blockOpts struct{}
@@ -182,7 +209,25 @@ func (o blockOpts) SetNotifier(n notifier.Notifier) BlockOpt {
 
 func (o blockOpts) SetSignatureFunc(f SignatureFunc) BlockOpt {
 	return func(m *blockManager) {
-		m.signFunc = f
+		m.signer = funcSigner(f)
+	}
+}
+
+// SetSigner sets the signer of messages, e.g. auth.NewEd25519Signer.
+func (o blockOpts) SetSigner(s auth.Signer) BlockOpt {
+	return func(m *blockManager) {
+		m.signer = s
+	}
+}
+
+// SetSignatureProfile sets the signer of the profile which webhooks may choose, nil to remove the profile.
+func (o blockOpts) SetSignatureProfile(profile string, s auth.Signer) BlockOpt {
+	return func(m *blockManager) {
+		if s == nil {
+			delete(m.profiles, profile)
+		} else {
+			m.profiles[profile] = s
+		}
 	}
 }
 
@@ -192,8 +237,75 @@ func (o blockOpts) SetNotifyTimeout(t time.Duration) BlockOpt {
 	}
 }
 
+// SetRetryCount sets max attempts with default backoff, see SetRetryPolicy.
 func (o blockOpts) SetRetryCount(n int) BlockOpt {
 	return func(m *blockManager) {
-		m.retryCount = n
+		m.retryPolicy = NewBackoffPolicy(n)
+	}
+}
+
+func (o blockOpts) SetRetryPolicy(p RetryPolicy) BlockOpt {
+	return func(m *blockManager) {
+		m.retryPolicy = p
+	}
+}
+
+// SetDeadLetterStore sets the store of deliveries which exhausted retries, nil to drop them.
+func (o blockOpts) SetDeadLetterStore(s deadletter.Store) BlockOpt {
+	return func(m *blockManager) {
+		m.deadLetters = s
+	}
+}
+
+// SetDeliveryLog sets the store of delivery attempts, nil to disable.
+func (o blockOpts) SetDeliveryLog(s deliverylog.Store) BlockOpt {
+	return func(m *blockManager) {
+		m.deliveryLog = s
+	}
+}
+
+// SetWorkers sets the max number of deliveries running at the same time.
+func (o blockOpts) SetWorkers(n int) BlockOpt {
+	return func(m *blockManager) {
+		m.workers = n
+	}
+}
+
+// SetWebhookConcurrency sets the max number of deliveries to one webhook running at the same time, 0 means no limit.
+func (o blockOpts) SetWebhookConcurrency(n int) BlockOpt {
+	return func(m *blockManager) {
+		m.perHook = n
+	}
+}
+
+// SetHostConcurrency sets the max number of deliveries to one host running at the same time, 0 means no limit.
+func (o blockOpts) SetHostConcurrency(n int) BlockOpt {
+	return func(m *blockManager) {
+		m.perHost = n
+	}
+}
+
+// SetQueueSize sets the max number of deliveries waiting for a worker, Notify blocks when the queue is full.
+// Default 0 means no limit.
+func (o blockOpts) SetQueueSize(n int) BlockOpt {
+	return func(m *blockManager) {
+		m.queueSize = n
+	}
+}
+
+// SetCircuitBreaker sets the config of the circuit breaker of each webhook, nil to disable.
+func (o blockOpts) SetCircuitBreaker(c *BreakerConfig) BlockOpt {
+	return func(m *blockManager) {
+		m.breaker = nil
+		if c != nil {
+			m.breaker = newBreakerGroup(*c)
+		}
+	}
+}
+
+// SetDeleteOnGone deletes webhooks which answered 410 Gone instead of setting them forbidden.
+func (o blockOpts) SetDeleteOnGone(del bool) BlockOpt {
+	return func(m *blockManager) {
+		m.deleteOnGone = del
 	}
 }
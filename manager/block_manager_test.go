@@ -0,0 +1,209 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"context"
+	"github.com/xfali/neve-webhook/events"
+	"github.com/xfali/neve-webhook/recorder"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBlockManagerDispatch(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ok.Close()
+	fail := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer fail.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r := recorder.NewMemRecorder()
+	for _, url := range []string{ok.URL + "/a", ok.URL + "/b", fail.URL} {
+		_, err := r.Create(ctx, recorder.Input{
+			Url:               url,
+			TriggerEventTypes: []string{"push"},
+			State:             recorder.HookStateNormal,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := NewBlockManager(r, BlockOpts.SetRetryCount(1))
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	ret, err := m.Dispatch(ctx, &events.Event{Type: "push", PayLoad: "test"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range ret.Responses() {
+		n++
+	}
+	if n != 3 {
+		t.Fatalf("Expect 3 responses but get %d\n", n)
+	}
+	summary, err := ret.Wait(ctx)
+	if err == nil {
+		t.Fatal("Expect error of failed delivery")
+	}
+	if summary.Total != 3 || summary.Succeeded != 2 || summary.Failed != 1 {
+		t.Fatalf("Unexpected summary: %+v\n", summary)
+	}
+}
+
+func TestBlockManagerPermanentFailure(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r := recorder.NewMemRecorder()
+	_, err := r.Create(ctx, recorder.Input{Url: server.URL, TriggerEventTypes: []string{"push"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewBackoffPolicy(3)
+	p.InitialInterval = time.Millisecond
+	m := NewBlockManager(r, BlockOpts.SetRetryPolicy(p))
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	ret, err := m.Dispatch(ctx, &events.Event{Type: "push", PayLoad: "test"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ret.Wait(ctx); err == nil {
+		t.Fatal("Expect error of failed delivery")
+	}
+	if count != 1 {
+		t.Fatalf("Expect no retry but get %d attempts\n", count)
+	}
+}
+
+func TestBlockManagerClose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r := recorder.NewMemRecorder()
+	_, err := r.Create(ctx, recorder.Input{Url: server.URL, TriggerEventTypes: []string{"push"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewBackoffPolicy(3)
+	p.InitialInterval = time.Hour
+	m := NewBlockManager(r, BlockOpts.SetRetryPolicy(p))
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	ret, err := m.Dispatch(ctx, &events.Event{Type: "push", PayLoad: "test"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for m.scheduler.Len() == 0 && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the retry is dropped on close
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := ret.Wait(ctx)
+	if ctx.Err() != nil {
+		t.Fatal("Expect finished on close")
+	}
+	if summary.Total != 1 || summary.Failed != 1 {
+		t.Fatalf("Unexpected summary: %+v\n", summary)
+	}
+
+	// partial result is returned if the pool stopped
+	ret, err = m.Dispatch(ctx, &events.Event{Type: "push", PayLoad: "test"}, nil)
+	if err != PoolStoppedErr || ret == nil {
+		t.Fatalf("Expect pool stopped with result but get %v\n", err)
+	}
+	if _, _ = ret.Wait(ctx); ctx.Err() != nil {
+		t.Fatal("Expect finished result")
+	}
+}
+
+type testPublisher chan events.IEvent
+
+func (p testPublisher) Publish(ctx context.Context, event events.IEvent) error {
+	p <- event
+	return nil
+}
+
+func TestBlockManagerGone(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r := recorder.NewMemRecorder()
+	id, err := r.Create(ctx, recorder.Input{Url: server.URL, TriggerEventTypes: []string{"push"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewBlockManager(r)
+	p := make(testPublisher, 1)
+	m.SetPublisher(p)
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	ret, err := m.Dispatch(ctx, &events.Event{Type: "push", PayLoad: "test"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret.Wait(ctx)
+	if state := hookState(t, r, id); state != recorder.HookStateForbidden {
+		t.Fatalf("Expect forbidden but get %s\n", state)
+	}
+	select {
+	case e := <-p:
+		if e.GetType() != events.WebhookGoneEventType {
+			t.Fatalf("Expect %s but get %s\n", events.WebhookGoneEventType, e.GetType())
+		}
+	default:
+		t.Fatal("Expect webhook gone event")
+	}
+}
@@ -0,0 +1,216 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"github.com/xfali/neve-webhook/events"
+	"github.com/xfali/neve-webhook/recorder"
+	"sync"
+	"time"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+
+	DefaultBreakerFailureThreshold = 5
+	DefaultBreakerErrorRate        = 0.5
+	DefaultBreakerMinRequests      = 20
+	DefaultBreakerWindow           = time.Minute
+	DefaultBreakerOpenTimeout      = 30 * time.Second
+)
+
+var CircuitOpenErr = errors.New("Circuit breaker is open ")
+
+type BreakerConfig struct {
+	// Consecutive failures to open the circuit, 0 means disabled.
+	FailureThreshold int
+	// Error rate in (0, 1] in the window to open the circuit, 0 means disabled.
+	ErrorRate float64
+	// Min number of deliveries in the window before the error rate is checked.
+	MinRequests int
+	// Length of the window counting the error rate.
+	Window time.Duration
+	// Time between probes while the circuit is open.
+	OpenTimeout time.Duration
+}
+
+func NewBreakerConfig() *BreakerConfig {
+	return &BreakerConfig{
+		FailureThreshold: DefaultBreakerFailureThreshold,
+		ErrorRate:        DefaultBreakerErrorRate,
+		MinRequests:      DefaultBreakerMinRequests,
+		Window:           DefaultBreakerWindow,
+		OpenTimeout:      DefaultBreakerOpenTimeout,
+	}
+}
+
+type circuitBreaker struct {
+	state       string
+	failures    int
+	requests    int
+	errors      int
+	windowStart time.Time
+}
+
+// breakerGroup holds a circuit breaker for each webhook, keyed by hookKey.
+type breakerGroup struct {
+	locker   sync.Mutex
+	config   BreakerConfig
+	breakers map[string]*circuitBreaker
+}
+
+func newBreakerGroup(config BreakerConfig) *breakerGroup {
+	return &breakerGroup{
+		config:   config,
+		breakers: map[string]*circuitBreaker{},
+	}
+}
+
+// allow returns false if deliveries to the webhook should not be made.
+func (g *breakerGroup) allow(id string) bool {
+	g.locker.Lock()
+	defer g.locker.Unlock()
+
+	b, ok := g.breakers[id]
+	return !ok || b.state == BreakerClosed
+}
+
+// record counts the result of a delivery, return true if the circuit turns open.
+func (g *breakerGroup) record(id string, success bool) bool {
+	g.locker.Lock()
+	defer g.locker.Unlock()
+
+	b, ok := g.breakers[id]
+	if !ok {
+		b = &circuitBreaker{state: BreakerClosed}
+		g.breakers[id] = b
+	}
+	if b.state != BreakerClosed {
+		return false
+	}
+	now := time.Now()
+	if now.Sub(b.windowStart) > g.config.Window {
+		b.windowStart = now
+		b.requests = 0
+		b.errors = 0
+	}
+	b.requests++
+	if success {
+		b.failures = 0
+		return false
+	}
+	b.failures++
+	b.errors++
+	if (g.config.FailureThreshold > 0 && b.failures >= g.config.FailureThreshold) ||
+		(g.config.ErrorRate > 0 && b.requests >= g.config.MinRequests &&
+			float64(b.errors) >= g.config.ErrorRate*float64(b.requests)) {
+		b.state = BreakerOpen
+		return true
+	}
+	return false
+}
+
+func (g *breakerGroup) setState(id string, state string) {
+	g.locker.Lock()
+	defer g.locker.Unlock()
+
+	if b, ok := g.breakers[id]; ok {
+		b.state = state
+	}
+}
+
+// reset closes the circuit of the webhook.
+func (g *breakerGroup) reset(id string) {
+	g.locker.Lock()
+	defer g.locker.Unlock()
+
+	delete(g.breakers, id)
+}
+
+// State returns the circuit breaker state of the webhook.
+func (g *breakerGroup) State(id string) string {
+	g.locker.Lock()
+	defer g.locker.Unlock()
+
+	if b, ok := g.breakers[id]; ok {
+		return b.state
+	}
+	return BreakerClosed
+}
+
+// trip moves the webhook of the delivery to abnormal and starts probing it.
+func (s *sender) trip(dl *delivery) {
+	id := dl.data.ID
+	s.logger.Warnf("Circuit of webhook %s is open\n", id)
+	if err := s.updateState(dl.context(context.Background()), id, recorder.HookStateNormal, recorder.HookStateAbnormal, "Circuit breaker is open"); err != nil {
+		s.logger.Errorln("Update webhook state failed: ", err)
+	}
+	s.scheduleProbe(dl.tenant, id)
+}
+
+func (s *sender) scheduleProbe(tenant, id string) {
+	s.scheduler.Schedule(s.breaker.config.OpenTimeout, func() {
+		go s.probe(tenant, id)
+	})
+}
+
+// probe sends a ping to the webhook of the tenant, the webhook is restored to normal if it succeeded.
+func (s *sender) probe(tenant, id string) {
+	ctx := context.Background()
+	if tenant != "" {
+		ctx = recorder.WithTenant(ctx, tenant)
+	}
+	key := hookKey(tenant, id)
+	datas, _, err := s.recorder.Query(ctx, recorder.QueryCondition{Id: id})
+	if err != nil {
+		s.breaker.reset(key)
+		return
+	}
+	if len(datas) == 0 {
+		s.forget(key)
+		return
+	}
+	if datas[0].State != recorder.HookStateAbnormal {
+		// state is changed by others
+		s.breaker.reset(key)
+		return
+	}
+	s.breaker.setState(key, BreakerHalfOpen)
+	dl := newDelivery(ctx, datas[0], &events.Event{
+		Type: events.PingEventType,
+		PayLoad: events.PingPayload{
+			WebhookID: id,
+			Time:      time.Now(),
+		},
+	})
+	dl.force = true
+	if _, err := s.attempt(ctx, dl); err != nil {
+		s.breaker.setState(key, BreakerOpen)
+		s.scheduleProbe(tenant, id)
+		return
+	}
+	s.breaker.reset(key)
+	s.logger.Infof("Circuit of webhook %s is closed\n", id)
+	if err := s.updateState(ctx, id, recorder.HookStateAbnormal, recorder.HookStateNormal, ""); err != nil {
+		s.logger.Errorln("Update webhook state failed: ", err)
+	}
+}
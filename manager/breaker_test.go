@@ -0,0 +1,129 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"context"
+	"github.com/xfali/neve-webhook/events"
+	"github.com/xfali/neve-webhook/recorder"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreakerGroup(t *testing.T) {
+	g := newBreakerGroup(BreakerConfig{
+		FailureThreshold: 3,
+		ErrorRate:        0.5,
+		MinRequests:      4,
+		Window:           time.Minute,
+	})
+	if g.record("1", false) || g.record("1", false) {
+		t.Fatal("Expect closed before threshold")
+	}
+	if !g.record("1", false) {
+		t.Fatal("Expect open after consecutive failures")
+	}
+	if g.allow("1") {
+		t.Fatal("Expect not allowed while open")
+	}
+
+	g.record("2", true)
+	g.record("2", false)
+	g.record("2", true)
+	if !g.record("2", false) {
+		t.Fatal("Expect open by error rate")
+	}
+	g.reset("2")
+	if g.State("2") != BreakerClosed {
+		t.Fatalf("Expect closed but get %s\n", g.State("2"))
+	}
+}
+
+func TestBreakerTenants(t *testing.T) {
+	m := NewBlockManager(recorder.NewMemRecorder(), BlockOpts.SetCircuitBreaker(&BreakerConfig{FailureThreshold: 1}))
+	if !m.breaker.record(hookKey("a", "1"), false) {
+		t.Fatal("Expect open after failure")
+	}
+	// webhooks of tenants have the same id
+	if m.breaker.State(hookKey("b", "1")) != BreakerClosed {
+		t.Fatal("Expect circuit of tenant b closed")
+	}
+	m.Forget(recorder.WithTenant(context.Background(), "a"), "1")
+	if len(m.breaker.breakers) != 0 {
+		t.Fatalf("Expect breaker removed but get %d\n", len(m.breaker.breakers))
+	}
+}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	var healthy int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r := recorder.NewMemRecorder()
+	id, err := r.Create(ctx, recorder.Input{Url: server.URL, TriggerEventTypes: []string{"push"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewBlockManager(r, BlockOpts.SetCircuitBreaker(&BreakerConfig{
+		FailureThreshold: 2,
+		OpenTimeout:      20 * time.Millisecond,
+	}))
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	for i := 0; i < 2; i++ {
+		ret, err := m.Dispatch(ctx, &events.Event{Type: "push", PayLoad: "test"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret.Wait(ctx)
+	}
+	if state := hookState(t, r, id); state != recorder.HookStateAbnormal {
+		t.Fatalf("Expect abnormal but get %s\n", state)
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	for hookState(t, r, id) != recorder.HookStateNormal {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Expect restored to normal")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func hookState(t *testing.T, r recorder.Recorder, id string) string {
+	datas, _, err := r.Query(context.Background(), recorder.QueryCondition{Id: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return datas[0].State
+}
@@ -20,12 +20,14 @@ package manager
 import (
 	"context"
 	"github.com/xfali/neve-webhook/auth"
-	"github.com/xfali/neve-webhook/errors"
+	"github.com/xfali/neve-webhook/deadletter"
+	"github.com/xfali/neve-webhook/deliverylog"
 	"github.com/xfali/neve-webhook/events"
 	"github.com/xfali/neve-webhook/notifier"
 	"github.com/xfali/neve-webhook/recorder"
 	"github.com/xfali/neve-webhook/serialize"
-	"github.com/xfali/xlog"
+	"net/http"
+	"strings"
 	"time"
 )
 
@@ -36,36 +38,41 @@ const (
 
 type Opt func(m *defaultManager)
 
-type SignatureFunc func(secret string) (string, error)
+// SignatureMeta is the metadata of a message to be signed.
+type SignatureMeta = auth.SignMeta
+
+// SignatureFunc signs the serialized body with the secret of the webhook.
+type SignatureFunc func(secret string, meta SignatureMeta, body []byte) (string, error)
 
 type defaultManager struct {
-	logger xlog.Logger
+	sender
 
-	recorder recorder.Recorder
-	notifier notifier.Notifier
 	eventSvc events.Service
+	pool     *workerPool
+
+	workers   int
+	perHook   int
+	perHost   int
+	queueSize int
+	ordered   bool
 
 	ctx    context.Context
 	cancel context.CancelFunc
-
-	signFunc      SignatureFunc
-	notifyTimeout time.Duration
-	retryCount    int
 }
 
 func NewManager(recorder recorder.Recorder, opts ...Opt) *defaultManager {
 	ret := &defaultManager{
-		logger:        xlog.GetLogger(),
-		recorder:      recorder,
-		eventSvc:      events.NewEventService(-1),
-		notifier:      notifier.NewHttpNotifier(nil),
-		signFunc:      defaultSignFunc,
-		notifyTimeout: NotifyTimeout,
-		retryCount:    DefaultRetryCount,
+		sender:    newSender(recorder),
+		eventSvc:  events.NewEventService(-1),
+		workers:   DefaultWorkers,
+		perHook:   DefaultWebhookConcurrency,
+		perHost:   DefaultHostConcurrency,
+		queueSize: DefaultQueueSize,
 	}
 	for _, opt := range opts {
 		opt(ret)
 	}
+	ret.pool = newWorkerPool(ret.workers, ret.perHook, ret.perHost, ret.queueSize, ret.limiters)
 	return ret
 }
 
@@ -83,16 +90,40 @@ func (m *defaultManager) Start() error {
 		return err
 	}
 	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.scheduler.Start()
+	m.pool.Start()
 	go m.loop()
 	return nil
 }
 
 func (m *defaultManager) Close() error {
 	m.cancel()
+	m.scheduler.Stop()
+	m.pool.Stop()
 
 	return m.eventSvc.Disconnect()
 }
 
+// RateLimiterState returns the rate limiter state of the webhook, nil if it has no rate limit.
+func (m *defaultManager) RateLimiterState(ctx context.Context, data recorder.Data) *RateLimiterState {
+	key := ctxHookKey(ctx, data.ID)
+	ret := m.limiters.state(key, data)
+	if ret != nil {
+		ret.Queued = m.pool.Pending(key)
+	}
+	return ret
+}
+
+// QueueDepth returns the number of deliveries waiting for a worker.
+func (m *defaultManager) QueueDepth() int {
+	return m.pool.Len()
+}
+
+// RetryDepth returns the number of deliveries waiting to retry.
+func (m *defaultManager) RetryDepth() int {
+	return m.scheduler.Len()
+}
+
 func (m *defaultManager) loop() {
 	for {
 		select {
@@ -113,13 +144,29 @@ func (m *defaultManager) loop() {
 }
 
 func (m *defaultManager) Notify(ctx context.Context, event events.IEvent, d serialize.Deserializer) (<-chan *notifier.Response, error) {
+	// the tenant is queued with the event
+	if tenant, ok := recorder.TenantFrom(ctx); ok && events.TenantOf(event) == "" {
+		event = events.WithTenant(event, tenant)
+	}
 	return nil, m.eventSvc.Put(ctx, event)
 }
 
+// doNotify submits deliveries of the event to the worker pool.
+// The event is acknowledged after all of its deliveries finished, it is left unacknowledged
+// to be delivered again if it failed to be submitted to any webhook.
 func (m *defaultManager) doNotify(ctx context.Context, event events.IEvent) error {
+	tracker := newEventTracker(func() {
+		if a, ok := m.eventSvc.(events.Acknowledger); ok {
+			err := a.Ack(m.ctx, event)
+			if err != nil {
+				m.logger.Warnln("Ack Event failed: ", err)
+			}
+		}
+	})
+	defer tracker.finish()
+
+	ctx = tenantContext(ctx, event)
 	offset := int64(0)
-	var errList errors.ErrList
-	now := time.Now()
 	for {
 		datas, _, err := m.recorder.Query(ctx, recorder.QueryCondition{
 			EventType: event.GetType(),
@@ -128,6 +175,7 @@ func (m *defaultManager) doNotify(ctx context.Context, event events.IEvent) erro
 			PageSize:  NotifySize,
 		})
 		if err != nil {
+			tracker.fail()
 			return err
 		}
 		if len(datas) == 0 {
@@ -135,42 +183,106 @@ func (m *defaultManager) doNotify(ctx context.Context, event events.IEvent) erro
 		}
 		offset++
 		for _, d := range datas {
-			secret, err := m.signFunc(d.Secret)
+			dl := newDelivery(ctx, d, event)
+			dl.tracker = tracker
+			tracker.add()
+			err = m.pool.Submit(&poolTask{
+				webhookID: dl.hookKey(),
+				host:      hostOf(d.Url),
+				rate:      d.RateLimit,
+				burst:     d.RateBurst,
+				key:       m.orderKey(dl),
+				run: func() bool {
+					return m.deliver(dl.context(m.ctx), dl)
+				},
+				drop: dl.fail,
+			})
 			if err != nil {
-				errList.Add(err)
-				m.logger.Errorln(err)
-				continue
+				dl.fail()
+				return err
 			}
-			nCtx, _ := context.WithTimeout(ctx, m.notifyTimeout)
-			for i := 0; i < m.retryCount; i++ {
-				_, err = m.notifier.Send(nCtx, d.Url, d.ContentType, secret, event)
-				if err != nil {
-					errList.Add(err)
-					m.logger.Errorln("Notifier send message failed: ", err)
-					err = m.recorder.UpdateNotifyStatus(ctx, d.ID, now, false)
-					if err != nil {
-						m.logger.Errorln("Recorder UpdateNotifyStatus failed: ", err)
-					}
-					continue
-				} else {
-					err = m.recorder.UpdateNotifyStatus(ctx, d.ID, now, true)
-					if err != nil {
-						m.logger.Errorln("Recorder UpdateNotifyStatus failed: ", err)
-					}
-					break
-				}
+		}
+	}
+	return nil
+}
+
+func (m *defaultManager) orderKey(dl *delivery) string {
+	if !m.ordered {
+		return ""
+	}
+	return dl.hookKey() + "/" + dl.event.GetType()
+}
+
+// deliver makes one attempt, a failed delivery is scheduled to retry according to the retry policy.
+// Return true if the delivery will be retried.
+func (m *defaultManager) deliver(ctx context.Context, dl *delivery) bool {
+	_, err := m.attempt(ctx, dl)
+	if err != nil {
+		retry := m.retryOrBury(ctx, dl, err, func() {
+			err := m.pool.Resubmit(&poolTask{
+				webhookID: dl.hookKey(),
+				host:      hostOf(dl.data.Url),
+				rate:      dl.data.RateLimit,
+				burst:     dl.data.RateBurst,
+				key:       m.orderKey(dl),
+				owner:     true,
+				run: func() bool {
+					return m.retry(dl)
+				},
+				drop: dl.fail,
+			})
+			if err != nil {
+				m.logger.Warnf("Drop retry of webhook %s: %v\n", dl.data.ID, err)
+				dl.fail()
 			}
+		}, dl.fail)
+		if retry {
+			return true
 		}
 	}
+	dl.finish()
+	return false
+}
 
-	if !errList.Empty() {
-		return errList
+func (m *defaultManager) retry(dl *delivery) bool {
+	ctx := dl.context(m.ctx)
+	// webhook may be updated or deleted while waiting
+	datas, _, err := m.recorder.Query(ctx, recorder.QueryCondition{Id: dl.data.ID})
+	if err != nil || len(datas) == 0 {
+		m.logger.Warnf("Drop retry of webhook %s: %v\n", dl.data.ID, err)
+		dl.finish()
+		return false
 	}
-	return nil
+	if datas[0].State == recorder.HookStateAbnormal {
+		// park it while the circuit is open
+		m.bury(ctx, dl, CircuitOpenErr)
+		dl.finish()
+		return false
+	}
+	if datas[0].State != recorder.HookStateNormal {
+		m.logger.Warnf("Drop retry of webhook %s, state: %s\n", dl.data.ID, datas[0].State)
+		dl.finish()
+		return false
+	}
+	dl.data = datas[0]
+	return m.deliver(ctx, dl)
 }
 
-func defaultSignFunc(secret string) (string, error) {
-	return auth.HmacSignature(auth.DefaultSignatureKey, secret)
+// funcSigner signs with each secret by SignatureFunc.
+type funcSigner SignatureFunc
+
+func (f funcSigner) Sign(secrets []string, meta SignatureMeta, body []byte) (http.Header, error) {
+	var sigs []string
+	for _, secret := range secrets {
+		sig, err := f(secret, meta, body)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, sig)
+	}
+	ret := http.Header{}
+	ret.Set(notifier.WebhookSignatureHeader, strings.Join(sigs, " "))
+	return ret, nil
 }
 
 type opts struct{}
@@ -191,7 +303,25 @@ func (o opts) SetNotifier(n notifier.Notifier) Opt {
 
 func (o opts) SetSignatureFunc(f SignatureFunc) Opt {
 	return func(m *defaultManager) {
-		m.signFunc = f
+		m.signer = funcSigner(f)
+	}
+}
+
+// SetSigner sets the signer of messages, e.g. auth.NewEd25519Signer.
+func (o opts) SetSigner(s auth.Signer) Opt {
+	return func(m *defaultManager) {
+		m.signer = s
+	}
+}
+
+// SetSignatureProfile sets the signer of the profile which webhooks may choose, nil to remove the profile.
+func (o opts) SetSignatureProfile(profile string, s auth.Signer) Opt {
+	return func(m *defaultManager) {
+		if s == nil {
+			delete(m.profiles, profile)
+		} else {
+			m.profiles[profile] = s
+		}
 	}
 }
 
@@ -201,8 +331,81 @@ func (o opts) SetNotifyTimeout(t time.Duration) Opt {
 	}
 }
 
+// SetRetryCount sets max attempts with default backoff, see SetRetryPolicy.
 func (o opts) SetRetryCount(n int) Opt {
 	return func(m *defaultManager) {
-		m.retryCount = n
+		m.retryPolicy = NewBackoffPolicy(n)
+	}
+}
+
+func (o opts) SetRetryPolicy(p RetryPolicy) Opt {
+	return func(m *defaultManager) {
+		m.retryPolicy = p
+	}
+}
+
+// SetDeadLetterStore sets the store of deliveries which exhausted retries, nil to drop them.
+func (o opts) SetDeadLetterStore(s deadletter.Store) Opt {
+	return func(m *defaultManager) {
+		m.deadLetters = s
+	}
+}
+
+// SetDeliveryLog sets the store of delivery attempts, nil to disable.
+func (o opts) SetDeliveryLog(s deliverylog.Store) Opt {
+	return func(m *defaultManager) {
+		m.deliveryLog = s
+	}
+}
+
+// SetWorkers sets the max number of deliveries running at the same time.
+func (o opts) SetWorkers(n int) Opt {
+	return func(m *defaultManager) {
+		m.workers = n
+	}
+}
+
+// SetWebhookConcurrency sets the max number of deliveries to one webhook running at the same time, 0 means no limit.
+func (o opts) SetWebhookConcurrency(n int) Opt {
+	return func(m *defaultManager) {
+		m.perHook = n
+	}
+}
+
+// SetHostConcurrency sets the max number of deliveries to one host running at the same time, 0 means no limit.
+func (o opts) SetHostConcurrency(n int) Opt {
+	return func(m *defaultManager) {
+		m.perHost = n
+	}
+}
+
+// SetQueueSize sets the max number of deliveries waiting for a worker, the event loop blocks when the queue is full.
+func (o opts) SetQueueSize(n int) Opt {
+	return func(m *defaultManager) {
+		m.queueSize = n
+	}
+}
+
+// SetCircuitBreaker sets the config of the circuit breaker of each webhook, nil to disable.
+func (o opts) SetCircuitBreaker(c *BreakerConfig) Opt {
+	return func(m *defaultManager) {
+		m.breaker = nil
+		if c != nil {
+			m.breaker = newBreakerGroup(*c)
+		}
+	}
+}
+
+// SetOrdered makes events of the same type delivered to a webhook one by one in order, retries included.
+func (o opts) SetOrdered(ordered bool) Opt {
+	return func(m *defaultManager) {
+		m.ordered = ordered
+	}
+}
+
+// SetDeleteOnGone deletes webhooks which answered 410 Gone instead of setting them forbidden.
+func (o opts) SetDeleteOnGone(del bool) Opt {
+	return func(m *defaultManager) {
+		m.deleteOnGone = del
 	}
 }
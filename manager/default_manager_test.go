@@ -0,0 +1,135 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"github.com/xfali/neve-webhook/events"
+	"github.com/xfali/neve-webhook/recorder"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestManagerNotifyTenant(t *testing.T) {
+	var countA, countB int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/a" {
+			atomic.AddInt32(&countA, 1)
+		} else {
+			atomic.AddInt32(&countB, 1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	r := recorder.NewSimpleRecorder(recorder.Opts.SetFilter(recorder.NewTenantFilter(recorder.NewMemRecorderFactory())))
+	for _, tenant := range []string{"a", "b"} {
+		_, err := r.Create(recorder.WithTenant(context.Background(), tenant), recorder.Input{
+			Url:               server.URL + "/" + tenant,
+			TriggerEventTypes: []string{"push"},
+			State:             recorder.HookStateNormal,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := NewManager(r)
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	ctx := recorder.WithTenant(context.Background(), "a")
+	if _, err := m.Notify(ctx, &events.Event{Type: "push", PayLoad: "test"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Notify(context.Background(), events.WithTenant(&events.Event{Type: "push", PayLoad: "test"}, "a"), nil); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&countA) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// wait for unexpected deliveries
+	time.Sleep(100 * time.Millisecond)
+	a, b := atomic.LoadInt32(&countA), atomic.LoadInt32(&countB)
+	if a != 2 || b != 0 {
+		t.Fatalf("Expect 2 deliveries to tenant a only but get %d %d\n", a, b)
+	}
+}
+
+type ackService struct {
+	events.Service
+	acked int32
+}
+
+func (s *ackService) Ack(ctx context.Context, event events.IEvent) error {
+	atomic.AddInt32(&s.acked, 1)
+	return nil
+}
+
+type failedRecorder struct {
+	recorder.Recorder
+}
+
+func (r *failedRecorder) Query(ctx context.Context, condition recorder.QueryCondition) ([]recorder.Data, int64, error) {
+	return nil, 0, errors.New("test")
+}
+
+func TestManagerAckOnlySubmitted(t *testing.T) {
+	event := &events.Event{Type: "push", PayLoad: "test"}
+	svc := &ackService{Service: events.NewEventService(-1)}
+	m := NewManager(&failedRecorder{Recorder: recorder.NewSimpleRecorder()}, Opts.SetEventService(svc))
+	if err := m.doNotify(context.Background(), event); err == nil {
+		t.Fatal("Expect query failed")
+	}
+	if svc.acked != 0 {
+		t.Fatal("Expect not acked if query failed")
+	}
+
+	r := recorder.NewSimpleRecorder()
+	_, err := r.Create(context.Background(), recorder.Input{
+		Url:               "http://localhost/a",
+		TriggerEventTypes: []string{"push"},
+		State:             recorder.HookStateNormal,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = NewManager(r, Opts.SetEventService(svc))
+	m.pool.Stop()
+	if err := m.doNotify(context.Background(), event); err != PoolStoppedErr {
+		t.Fatalf("Expect pool stopped but get %v\n", err)
+	}
+	if svc.acked != 0 {
+		t.Fatal("Expect not acked if not submitted")
+	}
+
+	m = NewManager(recorder.NewSimpleRecorder(), Opts.SetEventService(svc))
+	if err := m.doNotify(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if svc.acked != 1 {
+		t.Fatal("Expect acked if no webhook")
+	}
+}
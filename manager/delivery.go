@@ -0,0 +1,135 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"context"
+	"github.com/xfali/neve-webhook/deadletter"
+	"github.com/xfali/neve-webhook/deliverylog"
+	"github.com/xfali/neve-webhook/events"
+	"github.com/xfali/neve-webhook/recorder"
+	"sync/atomic"
+	"time"
+)
+
+// delivery is an event to be sent to one webhook.
+type delivery struct {
+	id        string
+	data      recorder.Data
+	event     events.IEvent
+	attempts  int
+	firstTime time.Time
+	history   []deadletter.Attempt
+	body      []byte
+	tracker   *eventTracker
+	// Bypass the circuit breaker.
+	force bool
+	// Tenant of the webhook, empty if ctx carries none.
+	tenant string
+}
+
+// newDelivery creates the delivery of the webhook of the tenant carried by ctx.
+func newDelivery(ctx context.Context, data recorder.Data, event events.IEvent) *delivery {
+	tenant, _ := recorder.TenantFrom(ctx)
+	return &delivery{
+		id:        deliverylog.NewID(),
+		data:      data,
+		event:     event,
+		firstTime: time.Now(),
+		tenant:    tenant,
+	}
+}
+
+// hookKey identifies the webhook of the tenant in states kept by managers, ids may be issued per tenant.
+func hookKey(tenant, id string) string {
+	if tenant == "" {
+		return id
+	}
+	return tenant + "/" + id
+}
+
+// ctxHookKey returns the hookKey of the webhook of the tenant carried by ctx.
+func ctxHookKey(ctx context.Context, id string) string {
+	tenant, _ := recorder.TenantFrom(ctx)
+	return hookKey(tenant, id)
+}
+
+func (dl *delivery) hookKey() string {
+	return hookKey(dl.tenant, dl.data.ID)
+}
+
+// context returns ctx carrying the tenant of the delivery.
+func (dl *delivery) context(ctx context.Context) context.Context {
+	if dl.tenant == "" {
+		return ctx
+	}
+	return recorder.WithTenant(ctx, dl.tenant)
+}
+
+// tenantContext returns ctx carrying the tenant of the event if it is bound to one.
+func tenantContext(ctx context.Context, event events.IEvent) context.Context {
+	if tenant := events.TenantOf(event); tenant != "" {
+		return recorder.WithTenant(ctx, tenant)
+	}
+	return ctx
+}
+
+// finish marks the delivery as done, no more attempt will be made.
+func (dl *delivery) finish() {
+	if dl.tracker != nil {
+		dl.tracker.finish()
+	}
+}
+
+// fail marks the delivery as dropped before it is delivered, the event is not acknowledged.
+func (dl *delivery) fail() {
+	if dl.tracker != nil {
+		dl.tracker.fail()
+		dl.tracker.finish()
+	}
+}
+
+// eventTracker calls done after all deliveries of an event finished, unless any of them failed.
+type eventTracker struct {
+	pending int32
+	failed  int32
+	done    func()
+}
+
+// newEventTracker creates a tracker holding one pending for submitting, release it by finish after submitted.
+func newEventTracker(done func()) *eventTracker {
+	return &eventTracker{
+		pending: 1,
+		done:    done,
+	}
+}
+
+func (t *eventTracker) add() {
+	atomic.AddInt32(&t.pending, 1)
+}
+
+// fail keeps done from being called, e.g. the event is not submitted to all webhooks.
+func (t *eventTracker) fail() {
+	atomic.StoreInt32(&t.failed, 1)
+}
+
+func (t *eventTracker) finish() {
+	if atomic.AddInt32(&t.pending, -1) == 0 && t.done != nil && atomic.LoadInt32(&t.failed) == 0 {
+		t.done()
+	}
+}
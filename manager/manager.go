@@ -19,8 +19,12 @@ package manager
 
 import (
 	"context"
+	"github.com/xfali/neve-webhook/auth"
+	"github.com/xfali/neve-webhook/deadletter"
+	"github.com/xfali/neve-webhook/deliverylog"
 	"github.com/xfali/neve-webhook/events"
 	"github.com/xfali/neve-webhook/notifier"
+	"github.com/xfali/neve-webhook/recorder"
 	"github.com/xfali/neve-webhook/serialize"
 )
 
@@ -29,5 +33,63 @@ type Manager interface {
 
 	Close() error
 
+	// Notify sends the event to webhooks subscribing it. The event is only sent to webhooks of its tenant,
+	// which is bound by events.WithTenant or carried by ctx, see recorder.WithTenant.
 	Notify(ctx context.Context, event events.IEvent, d serialize.Deserializer) (respChan <-chan *notifier.Response, err error)
+
+	// Send sends event to the webhook with the id synchronously, regardless of its trigger event types.
+	Send(ctx context.Context, id string, event events.IEvent, d serialize.Deserializer) (*notifier.Response, error)
+
+	// Redeliver sends the original payload of a past delivery to the webhook again.
+	Redeliver(ctx context.Context, id string, deliveryId string) (*notifier.Response, error)
+}
+
+// Dispatcher is implemented by managers which deliver events synchronously.
+type Dispatcher interface {
+	// Dispatch notifies the event to all matching webhooks, outcomes can be waited by the returned NotifyResult.
+	Dispatch(ctx context.Context, event events.IEvent, d serialize.Deserializer) (*NotifyResult, error)
+}
+
+// RateLimiterHolder is implemented by managers which limit the rate of deliveries to webhooks.
+type RateLimiterHolder interface {
+	// RateLimiterState returns the state of the webhook of the tenant carried by ctx.
+	RateLimiterState(ctx context.Context, data recorder.Data) *RateLimiterState
+}
+
+// WebhookStateHolder is implemented by managers which keep states of webhooks, e.g. circuit breakers and rate limiters.
+type WebhookStateHolder interface {
+	// Forget removes states of the deleted webhook of the tenant carried by ctx.
+	Forget(ctx context.Context, id string)
+}
+
+// Publisher publishes internal events of managers, e.g. a webhook is gone.
+type Publisher interface {
+	Publish(ctx context.Context, event events.IEvent) error
+}
+
+// PublisherAware is implemented by managers which publish internal events.
+type PublisherAware interface {
+	SetPublisher(p Publisher)
+}
+
+// SignatureProfileHolder is implemented by managers which sign messages by profiles.
+type SignatureProfileHolder interface {
+	// SignatureProfile returns the signer of the profile, empty profile means the default signer.
+	SignatureProfile(profile string) (auth.Signer, bool)
+}
+
+// KeyringHolder is implemented by managers which sign messages with asymmetric keys.
+type KeyringHolder interface {
+	// Ed25519Keyring returns nil if messages are not signed by Ed25519 keys.
+	Ed25519Keyring() *auth.Ed25519Keyring
+}
+
+// DeadLetterHolder is implemented by managers which keep deliveries exhausted retries.
+type DeadLetterHolder interface {
+	DeadLetterStore() deadletter.Store
+}
+
+// DeliveryLogHolder is implemented by managers which log delivery attempts.
+type DeliveryLogHolder interface {
+	DeliveryLog() deliverylog.Store
 }
@@ -0,0 +1,187 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"context"
+	"github.com/xfali/neve-webhook/errors"
+	"github.com/xfali/neve-webhook/notifier"
+	"sync"
+)
+
+// NotifySummary is the outcome of all deliveries of one notification.
+type NotifySummary struct {
+	// Responses of each subscription in finishing order.
+	Responses []*notifier.Response
+	Total     int
+	Succeeded int
+	Failed    int
+}
+
+// NotifyResult tracks the deliveries of one notification.
+// Responses are buffered so that workers never block on a slow reader.
+type NotifyResult struct {
+	locker   sync.Mutex
+	resps    []*notifier.Response
+	expected int
+	sealed   bool
+	done     chan struct{}
+	signal   chan struct{}
+	respChan chan *notifier.Response
+	ctx      context.Context
+}
+
+func newNotifyResult(ctx context.Context) *NotifyResult {
+	return &NotifyResult{
+		done:   make(chan struct{}),
+		signal: make(chan struct{}, 1),
+		ctx:    ctx,
+	}
+}
+
+// expect adds a delivery whose response will be collected.
+func (r *NotifyResult) expect() {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	r.expected++
+}
+
+// seal marks all deliveries are expected.
+func (r *NotifyResult) seal() {
+	r.locker.Lock()
+	r.sealed = true
+	r.checkDone()
+	r.locker.Unlock()
+	r.wakeup()
+}
+
+func (r *NotifyResult) add(resp *notifier.Response) {
+	r.locker.Lock()
+	r.resps = append(r.resps, resp)
+	r.checkDone()
+	r.locker.Unlock()
+	r.wakeup()
+}
+
+// checkDone must be called with lock held.
+func (r *NotifyResult) checkDone() {
+	if r.sealed && len(r.resps) == r.expected {
+		select {
+		case <-r.done:
+		default:
+			close(r.done)
+		}
+	}
+}
+
+func (r *NotifyResult) wakeup() {
+	select {
+	case r.signal <- struct{}{}:
+	default:
+	}
+}
+
+// Done returns a channel which is closed when all deliveries finished.
+func (r *NotifyResult) Done() <-chan struct{} {
+	return r.done
+}
+
+// Responses returns a channel of the response of each subscription.
+// The channel is closed when all deliveries finished or the context of the notification is done.
+func (r *NotifyResult) Responses() <-chan *notifier.Response {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	if r.respChan == nil {
+		size := r.expected
+		if size > ResponseChanBufferSize {
+			size = ResponseChanBufferSize
+		}
+		r.respChan = make(chan *notifier.Response, size)
+		go r.forward(r.respChan)
+	}
+	return r.respChan
+}
+
+func (r *NotifyResult) forward(respChan chan<- *notifier.Response) {
+	defer close(respChan)
+	sent := 0
+	for {
+		r.locker.Lock()
+		resps := r.resps[sent:]
+		r.locker.Unlock()
+
+		for _, resp := range resps {
+			select {
+			case <-r.ctx.Done():
+				return
+			case respChan <- resp:
+				sent++
+			}
+		}
+		if len(resps) > 0 {
+			continue
+		}
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-r.done:
+			r.locker.Lock()
+			finished := sent == len(r.resps)
+			r.locker.Unlock()
+			if finished {
+				return
+			}
+		case <-r.signal:
+		}
+	}
+}
+
+// Wait blocks until all deliveries finished or ctx is done.
+// The returned error combines errors of failed deliveries, or is the error of ctx with a partial summary.
+func (r *NotifyResult) Wait(ctx context.Context) (*NotifySummary, error) {
+	var err error
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-r.done:
+	}
+
+	r.locker.Lock()
+	ret := &NotifySummary{
+		Responses: make([]*notifier.Response, len(r.resps)),
+		Total:     r.expected,
+	}
+	copy(ret.Responses, r.resps)
+	r.locker.Unlock()
+
+	errs := errors.ErrList{}
+	for _, resp := range ret.Responses {
+		if resp.Error != nil {
+			ret.Failed++
+			errs.Add(resp.Error)
+		} else {
+			ret.Succeeded++
+		}
+	}
+	if err == nil && !errs.Empty() {
+		err = errs
+	}
+	return ret, err
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"github.com/xfali/neve-webhook/recorder"
+	"sync"
+	"time"
+)
+
+// RateLimiterState is the token bucket state of a webhook.
+type RateLimiterState struct {
+	// Tokens added per second.
+	Rate float64 `json:"rate" xml:"rate" yaml:"rate"`
+	// Max tokens in the bucket.
+	Burst int `json:"burst" xml:"burst" yaml:"burst"`
+	// Tokens currently available.
+	Tokens float64 `json:"tokens" xml:"tokens" yaml:"tokens"`
+	// Number of deliveries waiting for a token or a worker.
+	Queued int `json:"queued" xml:"queued" yaml:"queued"`
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+// burstOf returns the burst of the bucket, at least 1.
+func burstOf(burst int) int {
+	if burst <= 0 {
+		return 1
+	}
+	return burst
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	burst = burstOf(burst)
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+func (b *tokenBucket) advance(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += b.rate * elapsed.Seconds()
+		if b.tokens > float64(b.burst) {
+			b.tokens = float64(b.burst)
+		}
+		b.last = now
+	}
+}
+
+// take takes a token, returns 0 if succeeded, otherwise the time to wait for the next token.
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	b.advance(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// limiterGroup holds a token bucket for each webhook with rate limit, keyed by hookKey.
+type limiterGroup struct {
+	locker  sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newLimiterGroup() *limiterGroup {
+	return &limiterGroup{
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// take takes a token of the webhook, returns 0 if succeeded or no limit, otherwise the time to wait.
+func (g *limiterGroup) take(id string, rate float64, burst int) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	g.locker.Lock()
+	defer g.locker.Unlock()
+
+	now := time.Now()
+	b, ok := g.buckets[id]
+	if !ok || b.rate != rate || b.burst != burstOf(burst) {
+		b = newTokenBucket(rate, burst, now)
+		g.buckets[id] = b
+	}
+	return b.take(now)
+}
+
+// remove removes the bucket of the deleted webhook.
+func (g *limiterGroup) remove(key string) {
+	g.locker.Lock()
+	defer g.locker.Unlock()
+
+	delete(g.buckets, key)
+}
+
+// state returns nil if the webhook has no rate limit.
+func (g *limiterGroup) state(key string, data recorder.Data) *RateLimiterState {
+	if data.RateLimit <= 0 {
+		return nil
+	}
+	g.locker.Lock()
+	defer g.locker.Unlock()
+
+	now := time.Now()
+	b, ok := g.buckets[key]
+	if !ok || b.rate != data.RateLimit || b.burst != burstOf(data.RateBurst) {
+		b = newTokenBucket(data.RateLimit, data.RateBurst, now)
+	} else {
+		b.advance(now)
+	}
+	return &RateLimiterState{
+		Rate:   b.rate,
+		Burst:  b.burst,
+		Tokens: b.tokens,
+	}
+}
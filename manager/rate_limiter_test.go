@@ -0,0 +1,63 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"github.com/xfali/neve-webhook/recorder"
+	"strconv"
+	"testing"
+)
+
+func TestLimiterGroup(t *testing.T) {
+	g := newLimiterGroup()
+	for _, burst := range []int{0, 1, 3} {
+		id := strconv.Itoa(burst)
+		taken := 0
+		for i := 0; i < 100; i++ {
+			if g.take(id, 1, burst) == 0 {
+				taken++
+			}
+		}
+		if taken != burstOf(burst) {
+			t.Fatalf("Expect %d tokens with burst %d but get %d\n", burstOf(burst), burst, taken)
+		}
+		s := g.state(id, recorder.Data{ID: id, RateLimit: 1, RateBurst: burst})
+		if s.Burst != burstOf(burst) || s.Tokens >= 1 {
+			t.Fatalf("Expect drained bucket but get %+v\n", s)
+		}
+	}
+}
+
+func TestLimiterGroupTenants(t *testing.T) {
+	g := newLimiterGroup()
+	data := recorder.Data{ID: "1", RateLimit: 1, RateBurst: 1}
+	if g.take(hookKey("a", "1"), 1, 1) != 0 {
+		t.Fatal("Expect token taken")
+	}
+	// webhooks of tenants have the same id
+	if s := g.state(hookKey("b", "1"), data); s.Tokens < 1 {
+		t.Fatalf("Expect full bucket of tenant b but get %+v\n", s)
+	}
+	if s := g.state(hookKey("a", "1"), data); s.Tokens >= 1 {
+		t.Fatalf("Expect drained bucket of tenant a but get %+v\n", s)
+	}
+	g.remove(hookKey("a", "1"))
+	if len(g.buckets) != 0 {
+		t.Fatalf("Expect bucket removed but get %d\n", len(g.buckets))
+	}
+}
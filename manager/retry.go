@@ -0,0 +1,105 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	DefaultRetryInitialInterval = time.Second
+	DefaultRetryMaxInterval     = 5 * time.Minute
+	DefaultRetryMultiplier      = 2.0
+	DefaultRetryJitter          = 0.2
+	DefaultRetryMaxAge          = 24 * time.Hour
+)
+
+type RetryPolicy interface {
+	// NextDelay returns the delay before next attempt.
+	// attempts is the number of attempts have been made, elapsed is the time since the first attempt.
+	// Return false if no more attempt should be made.
+	NextDelay(attempts int, elapsed time.Duration) (time.Duration, bool)
+}
+
+// RetryAfterPolicy bounds the delay asked by Retry-After header of webhooks.
+// Policies not implementing it limit the delay to DefaultRetryMaxInterval.
+type RetryAfterPolicy interface {
+	// RetryAfter returns the delay to wait instead of the asked one, false if no more attempt should be made.
+	RetryAfter(delay time.Duration, elapsed time.Duration) (time.Duration, bool)
+}
+
+// BackoffPolicy retries with exponential backoff and random jitter.
+type BackoffPolicy struct {
+	// Max attempts including the first one, 0 means no limit.
+	MaxAttempts int
+	// Delay before the first retry.
+	InitialInterval time.Duration
+	// Upper bound of the delay.
+	MaxInterval time.Duration
+	// Factor the delay grows by after each retry.
+	Multiplier float64
+	// Ratio in [0, 1], the delay is randomized in [delay*(1-Jitter), delay*(1+Jitter)].
+	Jitter float64
+	// Max time since the first attempt, 0 means no limit.
+	MaxAge time.Duration
+}
+
+func NewBackoffPolicy(maxAttempts int) *BackoffPolicy {
+	return &BackoffPolicy{
+		MaxAttempts:     maxAttempts,
+		InitialInterval: DefaultRetryInitialInterval,
+		MaxInterval:     DefaultRetryMaxInterval,
+		Multiplier:      DefaultRetryMultiplier,
+		Jitter:          DefaultRetryJitter,
+		MaxAge:          DefaultRetryMaxAge,
+	}
+}
+
+func (p *BackoffPolicy) NextDelay(attempts int, elapsed time.Duration) (time.Duration, bool) {
+	if p.MaxAttempts > 0 && attempts >= p.MaxAttempts {
+		return 0, false
+	}
+	delay := float64(p.InitialInterval)
+	if p.Multiplier > 1 && attempts > 1 {
+		delay *= math.Pow(p.Multiplier, float64(attempts-1))
+	}
+	if p.MaxInterval > 0 && delay > float64(p.MaxInterval) {
+		delay = float64(p.MaxInterval)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	ret := time.Duration(delay)
+	if p.MaxAge > 0 && elapsed+ret > p.MaxAge {
+		return 0, false
+	}
+	return ret, true
+}
+
+// RetryAfter limits the delay to MaxInterval, the delivery is not retried if it exceeds MaxAge.
+func (p *BackoffPolicy) RetryAfter(delay time.Duration, elapsed time.Duration) (time.Duration, bool) {
+	if p.MaxInterval > 0 && delay > p.MaxInterval {
+		delay = p.MaxInterval
+	}
+	if p.MaxAge > 0 && elapsed+delay > p.MaxAge {
+		return 0, false
+	}
+	return delay, true
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffPolicy(t *testing.T) {
+	p := NewBackoffPolicy(4)
+	p.InitialInterval = time.Second
+	p.MaxInterval = 3 * time.Second
+	p.Jitter = 0.5
+	p.MaxAge = time.Minute
+
+	expects := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}
+	for i, expect := range expects {
+		d, ok := p.NextDelay(i+1, 0)
+		if !ok {
+			t.Fatalf("Expect retry after attempt %d\n", i+1)
+		}
+		if d < expect/2 || d > expect*3/2 {
+			t.Fatalf("Expect delay about %v but get %v\n", expect, d)
+		}
+	}
+	if _, ok := p.NextDelay(4, 0); ok {
+		t.Fatal("Expect no more retry after max attempts")
+	}
+	if _, ok := p.NextDelay(1, time.Minute); ok {
+		t.Fatal("Expect no more retry after max age")
+	}
+}
+
+func TestBackoffPolicyRetryAfter(t *testing.T) {
+	p := NewBackoffPolicy(4)
+	p.MaxInterval = time.Minute
+	p.MaxAge = time.Hour
+
+	if d, ok := p.RetryAfter(time.Second, 0); !ok || d != time.Second {
+		t.Fatalf("Expect %v but get %v %v\n", time.Second, d, ok)
+	}
+	if d, ok := p.RetryAfter(365*24*time.Hour, 0); !ok || d != time.Minute {
+		t.Fatalf("Expect %v but get %v %v\n", time.Minute, d, ok)
+	}
+	if _, ok := p.RetryAfter(time.Minute, time.Hour); ok {
+		t.Fatal("Expect no more retry after max age")
+	}
+	if d, ok := retryAfter(&fixedPolicy{}, 365*24*time.Hour, 0); !ok || d != DefaultRetryMaxInterval {
+		t.Fatalf("Expect %v but get %v %v\n", DefaultRetryMaxInterval, d, ok)
+	}
+}
+
+type fixedPolicy struct{}
+
+func (p *fixedPolicy) NextDelay(attempts int, elapsed time.Duration) (time.Duration, bool) {
+	return time.Second, true
+}
+
+func TestRetryScheduler(t *testing.T) {
+	s := newRetryScheduler()
+	s.Start()
+	defer s.Stop()
+
+	result := make(chan int, 3)
+	s.Schedule(60*time.Millisecond, func() { result <- 3 })
+	s.Schedule(20*time.Millisecond, func() { result <- 1 })
+	s.Schedule(40*time.Millisecond, func() { result <- 2 })
+	for i := 1; i <= 3; i++ {
+		select {
+		case v := <-result:
+			if v != i {
+				t.Fatalf("Expect %d but get %d\n", i, v)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout")
+		}
+	}
+	if s.Len() != 0 {
+		t.Fatalf("Expect 0 but get %d\n", s.Len())
+	}
+}
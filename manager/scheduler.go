@@ -0,0 +1,169 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+type scheduledTask struct {
+	at  time.Time
+	run func()
+	// drop is called if the task is dropped by Stop, nil means nothing to do.
+	drop func()
+}
+
+type taskHeap []*scheduledTask
+
+func (h taskHeap) Len() int           { return len(h) }
+func (h taskHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h taskHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *taskHeap) Push(x interface{}) {
+	*h = append(*h, x.(*scheduledTask))
+}
+
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return x
+}
+
+// retryScheduler holds delayed tasks in a heap and runs them in its own goroutine when they are due.
+type retryScheduler struct {
+	locker   sync.Mutex
+	tasks    taskHeap
+	wakeup   chan struct{}
+	stopChan chan struct{}
+}
+
+func newRetryScheduler() *retryScheduler {
+	return &retryScheduler{
+		wakeup: make(chan struct{}, 1),
+	}
+}
+
+func (s *retryScheduler) Start() {
+	s.stopChan = make(chan struct{})
+	go s.loop(s.stopChan)
+}
+
+// Stop stops the scheduler, tasks not yet run are dropped.
+func (s *retryScheduler) Stop() {
+	s.locker.Lock()
+	if s.stopChan == nil {
+		s.locker.Unlock()
+		return
+	}
+	select {
+	case <-s.stopChan:
+	default:
+		close(s.stopChan)
+	}
+	dropped := s.tasks
+	s.tasks = nil
+	s.locker.Unlock()
+
+	for _, t := range dropped {
+		if t.drop != nil {
+			t.drop()
+		}
+	}
+}
+
+func (s *retryScheduler) Schedule(delay time.Duration, run func()) {
+	s.ScheduleDroppable(delay, run, nil)
+}
+
+// ScheduleDroppable schedules the task, drop is called instead of run if the scheduler stopped before it is due.
+func (s *retryScheduler) ScheduleDroppable(delay time.Duration, run func(), drop func()) {
+	s.locker.Lock()
+	heap.Push(&s.tasks, &scheduledTask{
+		at:   time.Now().Add(delay),
+		run:  run,
+		drop: drop,
+	})
+	s.locker.Unlock()
+
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Len returns the number of tasks waiting.
+func (s *retryScheduler) Len() int {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	return len(s.tasks)
+}
+
+func (s *retryScheduler) loop(stopChan chan struct{}) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		now := time.Now()
+		wait := time.Hour
+		var due []*scheduledTask
+		s.locker.Lock()
+		for len(s.tasks) > 0 && !s.tasks[0].at.After(now) {
+			due = append(due, heap.Pop(&s.tasks).(*scheduledTask))
+		}
+		if len(s.tasks) > 0 {
+			wait = s.tasks[0].at.Sub(now)
+		}
+		s.locker.Unlock()
+
+		for i, t := range due {
+			select {
+			case <-stopChan:
+				for _, d := range due[i:] {
+					if d.drop != nil {
+						d.drop()
+					}
+				}
+				return
+			default:
+				t.run()
+			}
+		}
+		if len(due) > 0 {
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-stopChan:
+			return
+		case <-s.wakeup:
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,461 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/xfali/neve-webhook/auth"
+	"github.com/xfali/neve-webhook/deadletter"
+	"github.com/xfali/neve-webhook/deliverylog"
+	"github.com/xfali/neve-webhook/events"
+	"github.com/xfali/neve-webhook/notifier"
+	"github.com/xfali/neve-webhook/recorder"
+	"github.com/xfali/neve-webhook/serialize"
+	"github.com/xfali/xlog"
+	"net/http"
+	"time"
+)
+
+// sender holds what is shared by managers to deliver events to webhooks.
+type sender struct {
+	logger xlog.Logger
+
+	recorder    recorder.Recorder
+	notifier    notifier.Notifier
+	deadLetters deadletter.Store
+	deliveryLog deliverylog.Store
+
+	signer        auth.Signer
+	profiles      map[string]auth.Signer
+	notifyTimeout time.Duration
+	retryPolicy   RetryPolicy
+	scheduler     *retryScheduler
+	breaker       *breakerGroup
+	limiters      *limiterGroup
+	tokens        *notifier.TokenCache
+	publisher     Publisher
+	deleteOnGone  bool
+}
+
+func newSender(recorder recorder.Recorder) sender {
+	return sender{
+		logger:      xlog.GetLogger(),
+		recorder:    recorder,
+		notifier:    notifier.NewHttpNotifier(nil),
+		deadLetters: deadletter.NewMemStore(-1),
+		deliveryLog: deliverylog.NewMemStore(-1),
+		signer:      auth.StandardSigner{},
+		profiles: map[string]auth.Signer{
+			auth.SignProfileStandard: auth.StandardSigner{},
+			auth.SignProfileHttpSig:  auth.NewHttpSigSigner(nil),
+		},
+		notifyTimeout: NotifyTimeout,
+		retryPolicy:   NewBackoffPolicy(DefaultRetryCount),
+		scheduler:     newRetryScheduler(),
+		breaker:       newBreakerGroup(*NewBreakerConfig()),
+		limiters:      newLimiterGroup(),
+		tokens:        notifier.NewTokenCache(nil),
+	}
+}
+
+// Ed25519Keyring returns the keyring of Ed25519 signers, nil if no signer is Ed25519.
+func (s *sender) Ed25519Keyring() *auth.Ed25519Keyring {
+	if k := keyringOf(s.signer); k != nil {
+		return k
+	}
+	for _, v := range s.profiles {
+		if k := keyringOf(v); k != nil {
+			return k
+		}
+	}
+	return nil
+}
+
+func keyringOf(signer auth.Signer) *auth.Ed25519Keyring {
+	switch v := signer.(type) {
+	case *auth.Ed25519Signer:
+		return v.Keyring()
+	case *auth.HttpSigSigner:
+		return v.Keyring()
+	}
+	return nil
+}
+
+// SignatureProfile returns the signer of the profile, empty profile means the default signer.
+func (s *sender) SignatureProfile(profile string) (auth.Signer, bool) {
+	if profile == "" {
+		return s.signer, true
+	}
+	v, ok := s.profiles[profile]
+	return v, ok
+}
+
+func (s *sender) SetPublisher(p Publisher) {
+	s.publisher = p
+}
+
+func (s *sender) DeadLetterStore() deadletter.Store {
+	return s.deadLetters
+}
+
+func (s *sender) DeliveryLog() deliverylog.Store {
+	return s.deliveryLog
+}
+
+// Send sends event to the webhook synchronously, regardless of its state and trigger event types.
+func (s *sender) Send(ctx context.Context, id string, event events.IEvent, ds serialize.Deserializer) (*notifier.Response, error) {
+	datas, _, err := s.recorder.Query(ctx, recorder.QueryCondition{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	if len(datas) == 0 {
+		return nil, fmt.Errorf("ID %s not found ", id)
+	}
+	dl := newDelivery(ctx, datas[0], event)
+	dl.force = true
+	result, err := s.attempt(ctx, dl)
+	resp := newResponse(dl, result, err)
+	if err != nil {
+		return resp, err
+	}
+	if ds != nil {
+		resp.Payload, resp.Error = ds.Deserialize(result.Body)
+	}
+	return resp, resp.Error
+}
+
+// Redeliver sends the original payload of the delivery to the webhook again with a fresh signature.
+func (s *sender) Redeliver(ctx context.Context, id string, deliveryId string) (*notifier.Response, error) {
+	if s.deliveryLog == nil {
+		return nil, fmt.Errorf("Delivery log is not configured ")
+	}
+	d, err := s.deliveryLog.Get(ctx, deliveryId)
+	if err != nil {
+		return nil, err
+	}
+	if d.WebhookID != id {
+		return nil, fmt.Errorf("Delivery %s not found ", deliveryId)
+	}
+	datas, _, err := s.recorder.Query(ctx, recorder.QueryCondition{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	if len(datas) == 0 {
+		return nil, fmt.Errorf("ID %s not found ", id)
+	}
+	dl := newDelivery(ctx, datas[0], &events.Event{Type: d.EventType})
+	dl.id = d.ID
+	dl.data.ContentType = d.ContentType
+	dl.body = []byte(d.Body)
+	dl.attempts = len(d.Attempts)
+	dl.firstTime = d.CreateTime
+	dl.force = true
+	result, err := s.attempt(ctx, dl)
+	return newResponse(dl, result, err), err
+}
+
+// attempt makes one attempt of the delivery, updates the notify status of the webhook and logs the attempt.
+func (s *sender) attempt(ctx context.Context, dl *delivery) (*notifier.Result, error) {
+	var err error
+	if dl.body == nil {
+		dl.body, err = notifier.Marshal(dl.data.ContentType, dl.event.GetPayLoad())
+		if err != nil {
+			s.logger.Errorln("Marshal payload failed: ", err)
+			return nil, err
+		}
+	}
+	if !dl.force && s.breaker != nil && !s.breaker.allow(dl.hookKey()) {
+		return nil, CircuitOpenErr
+	}
+	nCtx, cancel := context.WithTimeout(ctx, s.notifyTimeout)
+	defer cancel()
+
+	if dl.attempts == 0 {
+		s.saveDelivery(ctx, dl)
+	}
+	now := time.Now()
+	signer, ok := s.SignatureProfile(dl.data.SignatureProfile)
+	if !ok {
+		err := fmt.Errorf("Signature profile %s not found ", dl.data.SignatureProfile)
+		s.logger.Errorln("Sign message failed: ", err)
+		return nil, err
+	}
+	header, err := signer.Sign(dl.data.Secrets(now), SignatureMeta{
+		MsgID:     dl.id,
+		WebhookID: dl.data.ID,
+		EventType: dl.event.GetType(),
+		Timestamp: now,
+		Method:    http.MethodPost,
+		Url:       dl.data.Url,
+	}, dl.body)
+	if err != nil {
+		s.logger.Errorln("Sign message failed: ", err)
+		return nil, err
+	}
+	dl.attempts++
+	result, err := s.notifier.Send(nCtx, &notifier.Message{
+		ID:          dl.id,
+		Url:         dl.data.Url,
+		ContentType: dl.data.ContentType,
+		EventType:   dl.event.GetType(),
+		Timestamp:   now,
+		Signature:   header.Get(notifier.WebhookSignatureHeader),
+		Header:      header,
+		Auth:        s.credentials(dl.data.OutboundAuth),
+		Body:        dl.body,
+	})
+	if errU := s.recorder.UpdateNotifyStatus(ctx, dl.data.ID, now, err == nil); errU != nil {
+		s.logger.Errorln("Recorder UpdateNotifyStatus failed: ", errU)
+	}
+	s.logAttempt(ctx, dl, now, result, err)
+	var respErr *notifier.ResponseError
+	if errors.As(err, &respErr) && respErr.StatusCode == http.StatusGone {
+		s.gone(ctx, dl, now)
+	} else if !dl.force && s.breaker != nil && s.breaker.record(dl.hookKey(), err == nil) {
+		s.trip(dl)
+	}
+	if err != nil {
+		s.logger.Errorln("Notifier send message failed: ", err)
+		dl.history = append(dl.history, deadletter.Attempt{
+			Time:  now,
+			Error: err.Error(),
+		})
+	}
+	return result, err
+}
+
+// credentials returns nil if the webhook needs no authentication.
+func (s *sender) credentials(a *recorder.OutboundAuth) notifier.Credentials {
+	if a == nil {
+		return nil
+	}
+	switch a.Type {
+	case recorder.OutboundAuthBasic:
+		return notifier.BasicAuth{Username: a.Username, Password: a.Password}
+	case recorder.OutboundAuthBearer:
+		return notifier.BearerToken(a.Token)
+	case recorder.OutboundAuthOAuth2:
+		return s.tokens.Credentials(notifier.ClientCredentials{
+			TokenUrl:     a.TokenUrl,
+			ClientID:     a.ClientID,
+			ClientSecret: a.ClientSecret,
+			Scopes:       a.Scopes,
+		})
+	}
+	return nil
+}
+
+// Forget removes states of the deleted webhook of the tenant carried by ctx.
+func (s *sender) Forget(ctx context.Context, id string) {
+	s.forget(ctxHookKey(ctx, id))
+}
+
+func (s *sender) forget(key string) {
+	if s.breaker != nil {
+		s.breaker.reset(key)
+	}
+	s.limiters.remove(key)
+}
+
+// gone forbids or deletes the webhook which answered 410 Gone.
+func (s *sender) gone(ctx context.Context, dl *delivery, now time.Time) {
+	reason := fmt.Sprintf("Webhook answered 410 Gone at %s", now.Format(time.RFC3339))
+	s.logger.Warnf("Webhook %s is gone, deleted: %v\n", dl.data.ID, s.deleteOnGone)
+	var err error
+	if s.deleteOnGone {
+		err = s.recorder.Delete(ctx, dl.data.ID)
+	} else {
+		err = s.updateState(ctx, dl.data.ID, "", recorder.HookStateForbidden, reason)
+	}
+	if err != nil {
+		s.logger.Errorln("Unsubscribe gone webhook failed: ", err)
+	}
+	if s.deleteOnGone {
+		s.forget(dl.hookKey())
+	} else if s.breaker != nil {
+		s.breaker.reset(dl.hookKey())
+	}
+	if s.publisher != nil {
+		err = s.publisher.Publish(ctx, &events.Event{
+			Type: events.WebhookGoneEventType,
+			PayLoad: events.WebhookGonePayload{
+				WebhookID: dl.data.ID,
+				Url:       dl.data.Url,
+				Reason:    reason,
+				Deleted:   s.deleteOnGone,
+				Time:      now,
+			},
+			Tenant: dl.tenant,
+		})
+		if err != nil {
+			s.logger.Errorln("Publish webhook gone event failed: ", err)
+		}
+	}
+}
+
+func (s *sender) saveDelivery(ctx context.Context, dl *delivery) {
+	if s.deliveryLog == nil {
+		return
+	}
+	err := s.deliveryLog.Save(ctx, deliverylog.Delivery{
+		ID:          dl.id,
+		WebhookID:   dl.data.ID,
+		Url:         dl.data.Url,
+		EventType:   dl.event.GetType(),
+		ContentType: dl.data.ContentType,
+		Body:        string(dl.body),
+		BodyDigest:  deliverylog.Digest(dl.body),
+		CreateTime:  dl.firstTime,
+	})
+	if err != nil {
+		s.logger.Errorln("Save delivery failed: ", err)
+	}
+}
+
+func (s *sender) logAttempt(ctx context.Context, dl *delivery, now time.Time, result *notifier.Result, err error) {
+	if s.deliveryLog == nil {
+		return
+	}
+	a := deliverylog.Attempt{
+		DeliveryID: dl.id,
+		WebhookID:  dl.data.ID,
+		Url:        dl.data.Url,
+		EventType:  dl.event.GetType(),
+		Attempt:    dl.attempts,
+		BodyDigest: deliverylog.Digest(dl.body),
+		Time:       now,
+	}
+	if result != nil {
+		a.RequestHeader = result.RequestHeader
+		a.StatusCode = result.StatusCode
+		a.ResponseBody = deliverylog.Truncate(result.Body)
+		a.Latency = result.Latency
+	}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	if errA := s.deliveryLog.AddAttempt(ctx, a); errA != nil {
+		s.logger.Errorln("Log delivery attempt failed: ", errA)
+	}
+}
+
+func newResponse(dl *delivery, result *notifier.Result, err error) *notifier.Response {
+	ret := &notifier.Response{
+		WebhookID:  dl.data.ID,
+		Url:        dl.data.Url,
+		DeliveryID: dl.id,
+		Attempts:   dl.attempts,
+		Error:      err,
+	}
+	if result != nil {
+		ret.StatusCode = result.StatusCode
+		ret.Latency = result.Latency
+		ret.Body = result.Body
+	}
+	return ret
+}
+
+// retryOrBury schedules the failed delivery to retry, or puts it to the dead letter store if retries exhausted.
+// Deliveries rejected by the open circuit or failed permanently are put to the dead letter store directly.
+// drop is called instead of retry if the retry is dropped on stop.
+// Return false if the delivery will not be retried.
+func (s *sender) retryOrBury(ctx context.Context, dl *delivery, err error, retry func(), drop func()) bool {
+	if retryable(err) {
+		elapsed := time.Since(dl.firstTime)
+		delay, ok := s.retryPolicy.NextDelay(dl.attempts, elapsed)
+		var respErr *notifier.ResponseError
+		if ok && errors.As(err, &respErr) {
+			// the webhook knows better when to come back, within bounds of the policy
+			if after, has := respErr.RetryAfter(time.Now()); has && after > delay {
+				delay, ok = retryAfter(s.retryPolicy, after, elapsed)
+			}
+		}
+		if ok {
+			s.scheduler.ScheduleDroppable(delay, retry, drop)
+			return true
+		}
+	}
+	s.bury(ctx, dl, err)
+	return false
+}
+
+func retryAfter(policy RetryPolicy, delay, elapsed time.Duration) (time.Duration, bool) {
+	if p, ok := policy.(RetryAfterPolicy); ok {
+		return p.RetryAfter(delay, elapsed)
+	}
+	if delay > DefaultRetryMaxInterval {
+		delay = DefaultRetryMaxInterval
+	}
+	return delay, true
+}
+
+// retryable returns false if retrying the delivery will not help.
+func retryable(err error) bool {
+	if err == CircuitOpenErr {
+		return false
+	}
+	var respErr *notifier.ResponseError
+	if errors.As(err, &respErr) {
+		return !respErr.Permanent()
+	}
+	return true
+}
+
+func (s *sender) bury(ctx context.Context, dl *delivery, err error) {
+	s.logger.Warnf("Give up notifying %s to webhook %s after %d attempts: %v\n", dl.event.GetType(), dl.data.ID, dl.attempts, err)
+	if s.deadLetters != nil {
+		_, errP := s.deadLetters.Put(ctx, deadletter.Letter{
+			WebhookID: dl.data.ID,
+			Url:       dl.data.Url,
+			EventType: dl.event.GetType(),
+			PayLoad:   dl.event.GetPayLoad(),
+			LastError: err.Error(),
+			Attempts:  dl.history,
+		})
+		if errP != nil {
+			s.logger.Errorln("Put dead letter failed: ", errP)
+		}
+	}
+}
+
+// updateState sets the state of the webhook with the reason if it is in the expected state, empty expect means any.
+func (s *sender) updateState(ctx context.Context, id string, expect, state, reason string) error {
+	datas, _, err := s.recorder.Query(ctx, recorder.QueryCondition{Id: id})
+	if err != nil {
+		return err
+	}
+	if len(datas) == 0 || (expect != "" && datas[0].State != expect) {
+		return nil
+	}
+	d := datas[0]
+	return s.recorder.Update(ctx, id, recorder.Input{
+		Url:               d.Url,
+		ContentType:       d.ContentType,
+		Secret:            d.Secret,
+		TriggerEventTypes: d.TriggerEventTypes,
+		State:             state,
+		StateReason:       reason,
+		RateLimit:         d.RateLimit,
+		RateBurst:         d.RateBurst,
+		SignatureProfile:  d.SignatureProfile,
+		OutboundAuth:      d.OutboundAuth,
+		VerificationToken: d.VerificationToken,
+	})
+}
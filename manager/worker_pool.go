@@ -0,0 +1,296 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"container/list"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWorkers            = 16
+	DefaultWebhookConcurrency = 4
+	DefaultHostConcurrency    = 0
+	DefaultQueueSize          = 4096
+)
+
+var PoolStoppedErr = errors.New("Worker pool stopped ")
+
+type poolTask struct {
+	// hookKey of the webhook
+	webhookID string
+	host      string
+	// Rate limit of the webhook, 0 means no limit.
+	rate  float64
+	burst int
+	// Tasks with the same key run one by one in submitted order, empty means no order.
+	key string
+	// The task already holds its key, e.g. the retry of a delivery.
+	owner bool
+	// run returns true to keep holding the key after the task finished.
+	run func() (hold bool)
+	// drop is called if the task is dropped by Stop, nil means nothing to do.
+	drop func()
+}
+
+// workerPool runs tasks with bounded global, per webhook and per host concurrency.
+type workerPool struct {
+	locker   sync.Mutex
+	ready    *sync.Cond
+	notFull  *sync.Cond
+	workers  int
+	perHook  int
+	perHost  int
+	capacity int
+	limiters *limiterGroup
+
+	tasks   *list.List
+	running map[string]int
+	hosts   map[string]int
+	holding map[string]struct{}
+	active  int
+	stopped bool
+	timer   *time.Timer
+	timerAt time.Time
+}
+
+// newWorkerPool creates a pool, 0 of perHook or perHost means no limit, 0 of capacity means unbounded queue.
+// Tasks of webhooks with rate limit wait in the queue for tokens of limiters.
+func newWorkerPool(workers, perHook, perHost, capacity int, limiters *limiterGroup) *workerPool {
+	ret := &workerPool{
+		workers:  workers,
+		perHook:  perHook,
+		perHost:  perHost,
+		capacity: capacity,
+		limiters: limiters,
+		tasks:    list.New(),
+		running:  map[string]int{},
+		hosts:    map[string]int{},
+		holding:  map[string]struct{}{},
+	}
+	ret.ready = sync.NewCond(&ret.locker)
+	ret.notFull = sync.NewCond(&ret.locker)
+	return ret
+}
+
+func (p *workerPool) Start() {
+	p.locker.Lock()
+	p.stopped = false
+	p.locker.Unlock()
+
+	workers := p.workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+}
+
+// Stop stops the workers, tasks not yet run are dropped.
+func (p *workerPool) Stop() {
+	p.locker.Lock()
+	var dropped []*poolTask
+	for e := p.tasks.Front(); e != nil; e = e.Next() {
+		dropped = append(dropped, e.Value.(*poolTask))
+	}
+	p.stopped = true
+	p.tasks.Init()
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	p.ready.Broadcast()
+	p.notFull.Broadcast()
+	p.locker.Unlock()
+
+	for _, t := range dropped {
+		if t.drop != nil {
+			t.drop()
+		}
+	}
+}
+
+// Submit queues the task, blocks while the queue is full.
+func (p *workerPool) Submit(t *poolTask) error {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	for !p.stopped && p.capacity > 0 && p.tasks.Len() >= p.capacity {
+		p.notFull.Wait()
+	}
+	if p.stopped {
+		return PoolStoppedErr
+	}
+	p.tasks.PushBack(t)
+	p.ready.Signal()
+	return nil
+}
+
+// Resubmit queues the task regardless of the capacity of the queue.
+func (p *workerPool) Resubmit(t *poolTask) error {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.stopped {
+		return PoolStoppedErr
+	}
+	p.tasks.PushBack(t)
+	p.ready.Signal()
+	return nil
+}
+
+// Len returns the number of tasks waiting.
+func (p *workerPool) Len() int {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return p.tasks.Len()
+}
+
+// Pending returns the number of tasks of the webhook waiting.
+func (p *workerPool) Pending(webhookID string) int {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	ret := 0
+	for e := p.tasks.Front(); e != nil; e = e.Next() {
+		if e.Value.(*poolTask).webhookID == webhookID {
+			ret++
+		}
+	}
+	return ret
+}
+
+// Active returns the number of tasks running.
+func (p *workerPool) Active() int {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return p.active
+}
+
+func (p *workerPool) work() {
+	for {
+		p.locker.Lock()
+		var t *poolTask
+		for {
+			if p.stopped {
+				p.locker.Unlock()
+				return
+			}
+			if t = p.next(); t != nil {
+				break
+			}
+			p.ready.Wait()
+		}
+		p.active++
+		p.running[t.webhookID]++
+		p.hosts[t.host]++
+		if t.key != "" {
+			p.holding[t.key] = struct{}{}
+		}
+		p.notFull.Signal()
+		p.locker.Unlock()
+
+		hold := t.run()
+
+		p.locker.Lock()
+		p.active--
+		if p.running[t.webhookID]--; p.running[t.webhookID] <= 0 {
+			delete(p.running, t.webhookID)
+		}
+		if p.hosts[t.host]--; p.hosts[t.host] <= 0 {
+			delete(p.hosts, t.host)
+		}
+		if t.key != "" && !hold {
+			delete(p.holding, t.key)
+		}
+		// finished task may make others runnable
+		p.ready.Broadcast()
+		p.locker.Unlock()
+	}
+}
+
+// next removes and returns the first runnable task, must be called with lock held.
+func (p *workerPool) next() *poolTask {
+	var wait time.Duration
+	limited := map[string]struct{}{}
+	for e := p.tasks.Front(); e != nil; e = e.Next() {
+		t := e.Value.(*poolTask)
+		if p.perHook > 0 && p.running[t.webhookID] >= p.perHook {
+			continue
+		}
+		if p.perHost > 0 && p.hosts[t.host] >= p.perHost {
+			continue
+		}
+		if t.key != "" && !t.owner {
+			if _, ok := p.holding[t.key]; ok {
+				continue
+			}
+		}
+		if p.limiters != nil && t.rate > 0 {
+			if _, ok := limited[t.webhookID]; ok {
+				continue
+			}
+			if d := p.limiters.take(t.webhookID, t.rate, t.burst); d > 0 {
+				limited[t.webhookID] = struct{}{}
+				if wait == 0 || d < wait {
+					wait = d
+				}
+				continue
+			}
+		}
+		p.tasks.Remove(e)
+		return t
+	}
+	if wait > 0 {
+		p.wakeupAfter(wait)
+	}
+	return nil
+}
+
+// wakeupAfter wakes up workers when tokens are available, must be called with lock held.
+func (p *workerPool) wakeupAfter(d time.Duration) {
+	at := time.Now().Add(d)
+	if p.timer != nil {
+		if !p.timerAt.After(at) {
+			return
+		}
+		p.timer.Stop()
+	}
+	p.timerAt = at
+	p.timer = time.AfterFunc(d, func() {
+		p.locker.Lock()
+		defer p.locker.Unlock()
+
+		p.timer = nil
+		p.ready.Broadcast()
+	})
+}
+
+func hostOf(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	return u.Host
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolOrdered(t *testing.T) {
+	p := newWorkerPool(8, 0, 0, 0, nil)
+	p.Start()
+	defer p.Stop()
+
+	var locker sync.Mutex
+	var result []int
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		v := i
+		wg.Add(1)
+		err := p.Submit(&poolTask{
+			webhookID: "1",
+			key:       "1/push",
+			run: func() bool {
+				defer wg.Done()
+				time.Sleep(time.Millisecond)
+				locker.Lock()
+				result = append(result, v)
+				locker.Unlock()
+				return false
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	for i, v := range result {
+		if v != i {
+			t.Fatalf("Expect %d but get %d\n", i, v)
+		}
+	}
+}
+
+func TestWorkerPoolWebhookConcurrency(t *testing.T) {
+	p := newWorkerPool(8, 2, 0, 0, nil)
+	p.Start()
+	defer p.Stop()
+
+	var running, max int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		err := p.Submit(&poolTask{
+			webhookID: "1",
+			run: func() bool {
+				defer wg.Done()
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&max)
+					if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return false
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if max > 2 {
+		t.Fatalf("Expect at most 2 but get %d\n", max)
+	}
+}
+
+func TestWorkerPoolHostConcurrency(t *testing.T) {
+	p := newWorkerPool(8, 0, 1, 0, nil)
+	p.Start()
+	defer p.Stop()
+
+	var running, max int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		err := p.Submit(&poolTask{
+			webhookID: string(rune('a' + i)),
+			host:      hostOf("http://localhost:8080/hook"),
+			run: func() bool {
+				defer wg.Done()
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&max)
+					if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+						break
+					}
+				}
+				time.Sleep(2 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return false
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if max > 1 {
+		t.Fatalf("Expect at most 1 but get %d\n", max)
+	}
+}
+
+func TestWorkerPoolRateLimit(t *testing.T) {
+	p := newWorkerPool(8, 0, 0, 0, newLimiterGroup())
+	p.Start()
+	defer p.Stop()
+
+	var count int32
+	wg := sync.WaitGroup{}
+	now := time.Now()
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		err := p.Submit(&poolTask{
+			webhookID: "1",
+			rate:      50,
+			burst:     2,
+			run: func() bool {
+				defer wg.Done()
+				atomic.AddInt32(&count, 1)
+				return false
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	// 2 run at once, others wait 20ms for each token
+	if elapsed := time.Since(now); elapsed < 60*time.Millisecond {
+		t.Fatalf("Expect limited but finished in %v\n", elapsed)
+	}
+	if count != 6 {
+		t.Fatalf("Expect 6 but get %d\n", count)
+	}
+}
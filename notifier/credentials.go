@@ -0,0 +1,207 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Lifetime of tokens without expires_in
+	DefaultTokenLifetime = 5 * time.Minute
+	// Tokens are refreshed before expiry
+	tokenExpirySkew = 30 * time.Second
+)
+
+// Credentials authenticates requests to webhooks.
+type Credentials interface {
+	Apply(ctx context.Context, req *http.Request) error
+}
+
+// Invalidator is implemented by credentials which are cached, they are invalidated if the webhook answered 401.
+type Invalidator interface {
+	Invalidate()
+}
+
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a BasicAuth) Apply(ctx context.Context, req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+type BearerToken string
+
+func (t BearerToken) Apply(ctx context.Context, req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
+
+// ClientCredentials is the config of OAuth2 client credentials grant.
+type ClientCredentials struct {
+	TokenUrl     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+type token struct {
+	locker sync.Mutex
+	value  string
+	expire time.Time
+}
+
+// TokenCache fetches OAuth2 tokens by client credentials and caches them until expiry.
+type TokenCache struct {
+	client *http.Client
+	locker sync.Mutex
+	tokens map[string]*token
+}
+
+func NewTokenCache(client *http.Client) *TokenCache {
+	if client == nil {
+		// client secrets must not be posted without verifying the token endpoint
+		client = &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: http.DefaultTransport,
+		}
+	}
+	return &TokenCache{
+		client: client,
+		tokens: map[string]*token{},
+	}
+}
+
+// Credentials returns credentials applying the cached token of the client.
+func (c *TokenCache) Credentials(cc ClientCredentials) Credentials {
+	return &cachedToken{
+		cache: c,
+		conf:  cc,
+	}
+}
+
+func (c *TokenCache) get(key string) *token {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	t, ok := c.tokens[key]
+	if !ok {
+		t = &token{}
+		c.tokens[key] = t
+	}
+	return t
+}
+
+// Token returns the cached token, a new one is fetched if it is expired.
+func (c *TokenCache) Token(ctx context.Context, cc ClientCredentials) (string, error) {
+	t := c.get(cacheKey(cc))
+	// concurrent deliveries wait for one fetching
+	t.locker.Lock()
+	defer t.locker.Unlock()
+
+	if t.value != "" && time.Now().Before(t.expire) {
+		return t.value, nil
+	}
+	value, lifetime, err := c.fetch(ctx, cc)
+	if err != nil {
+		return "", err
+	}
+	t.value = value
+	t.expire = time.Now().Add(lifetime - tokenExpirySkew)
+	return value, nil
+}
+
+// Invalidate drops the cached token of the client.
+func (c *TokenCache) Invalidate(cc ClientCredentials) {
+	t := c.get(cacheKey(cc))
+	t.locker.Lock()
+	defer t.locker.Unlock()
+
+	t.value = ""
+}
+
+func (c *TokenCache) fetch(ctx context.Context, cc ClientCredentials) (string, time.Duration, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(cc.Scopes) > 0 {
+		form.Set("scope", strings.Join(cc.Scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cc.TokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(cc.ClientID), url.QueryEscape(cc.ClientSecret))
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	d, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("Fetch token from %s failed, http status: %d, response: %s ", cc.TokenUrl, resp.StatusCode, string(d))
+	}
+	v := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}{}
+	if err := json.Unmarshal(d, &v); err != nil {
+		return "", 0, err
+	}
+	if v.AccessToken == "" {
+		return "", 0, fmt.Errorf("No access token from %s ", cc.TokenUrl)
+	}
+	lifetime := DefaultTokenLifetime
+	if v.ExpiresIn > 0 {
+		lifetime = time.Duration(v.ExpiresIn) * time.Second
+	}
+	return v.AccessToken, lifetime, nil
+}
+
+func cacheKey(cc ClientCredentials) string {
+	return cc.TokenUrl + "\n" + cc.ClientID + "\n" + cc.ClientSecret + "\n" + strings.Join(cc.Scopes, " ")
+}
+
+type cachedToken struct {
+	cache *TokenCache
+	conf  ClientCredentials
+}
+
+func (t *cachedToken) Apply(ctx context.Context, req *http.Request) error {
+	v, err := t.cache.Token(ctx, t.conf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+v)
+	return nil
+}
+
+func (t *cachedToken) Invalidate() {
+	t.cache.Invalidate(t.conf)
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notifier
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClientCredentials(t *testing.T) {
+	var fetched int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "client" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := atomic.AddInt32(&fetched, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token` + strconv.Itoa(int(n)) + `","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+	revoked := "token1"
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer "+revoked {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer hook.Close()
+
+	cache := NewTokenCache(nil)
+	cred := cache.Credentials(ClientCredentials{
+		TokenUrl:     tokenServer.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+	})
+	n := NewHttpNotifier(nil)
+	ctx := context.Background()
+	revoked = ""
+	for i := 0; i < 2; i++ {
+		result, err := n.Send(ctx, &Message{Url: hook.URL, Auth: cred})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := result.RequestHeader.Get("Authorization"); v != "******" {
+			t.Fatalf("Expect redacted but get %s\n", v)
+		}
+	}
+	if fetched != 1 {
+		t.Fatalf("Expect fetched once but get %d\n", fetched)
+	}
+	// token is fetched again after 401
+	revoked = "token1"
+	if _, err := n.Send(ctx, &Message{Url: hook.URL, Auth: cred}); err == nil {
+		t.Fatal("Expect unauthorized")
+	}
+	if _, err := n.Send(ctx, &Message{Url: hook.URL, Auth: cred}); err != nil {
+		t.Fatal(err)
+	}
+	if fetched != 2 {
+		t.Fatalf("Expect fetched twice but get %d\n", fetched)
+	}
+}
+
+func TestClientCredentialsVerifyTLS(t *testing.T) {
+	tokenServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+
+	cred := NewTokenCache(nil).Credentials(ClientCredentials{
+		TokenUrl:     tokenServer.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	if err := cred.Apply(context.Background(), req); err == nil {
+		t.Fatal("Expect certificate of token server not trusted")
+	}
+	cred = NewTokenCache(tokenServer.Client()).Credentials(ClientCredentials{
+		TokenUrl:     tokenServer.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+	})
+	if err := cred.Apply(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCredentialsVerifyReceiverTLS(t *testing.T) {
+	var authorized int32
+	hook := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			atomic.AddInt32(&authorized, 1)
+		}
+	}))
+	defer hook.Close()
+
+	msg := &Message{Url: hook.URL, Auth: BearerToken("test-token")}
+	if _, err := NewHttpNotifier(nil).Send(context.Background(), msg); err == nil {
+		t.Fatal("Expect certificate of receiver not trusted")
+	}
+	if authorized != 0 {
+		t.Fatalf("Expect credentials not sent but get %d\n", authorized)
+	}
+	if _, err := NewHttpNotifier(hook.Client()).Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -20,23 +20,38 @@ package notifier
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"encoding/xml"
-	"fmt"
-	"github.com/xfali/neve-webhook/events"
+	"github.com/xfali/neve-webhook/auth"
 	"github.com/xfali/xlog"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	DefaultContentType = "application/json"
+)
+
 var (
-	EventTypeHeader      = "X-Neve-WebHook-Event"
+	EventTypeHeader      = auth.EventTypeHeader
 	EventSignatureHeader = "X-Neve-WebHook-Signature"
+	DeliveryIDHeader     = "X-Neve-WebHook-Delivery"
+
+	// Headers of Standard Webhooks
+	WebhookIDHeader        = auth.WebhookIDHeader
+	WebhookTimestampHeader = auth.WebhookTimestampHeader
+	WebhookSignatureHeader = auth.WebhookSignatureHeader
+	WebhookKeyIDHeader     = auth.WebhookKeyIDHeader
+
+	// Headers of RFC 9421 HTTP Message Signatures
+	ContentDigestHeader  = auth.ContentDigestHeader
+	SignatureInputHeader = auth.SignatureInputHeader
+	SignatureHeader      = auth.SignatureHeader
 )
 
 func defaultTransportDialContext(dialer *net.Dialer) func(context.Context, string, string) (net.Conn, error) {
@@ -54,9 +69,6 @@ var DefaultTransport http.RoundTripper = &http.Transport{
 	IdleConnTimeout:       90 * time.Second,
 	TLSHandshakeTimeout:   10 * time.Second,
 	ExpectContinueTimeout: 1 * time.Second,
-	TLSClientConfig: &tls.Config{
-		InsecureSkipVerify: true,
-	},
 }
 
 type httpNotifier struct {
@@ -78,58 +90,102 @@ func NewHttpNotifier(client *http.Client) *httpNotifier {
 	return ret
 }
 
-func (n *httpNotifier) Send(ctx context.Context, url string, contentType string, secretSign string, event events.IEvent) ([]byte, error) {
-	var data []byte
-	var err error
+func (n *httpNotifier) Send(ctx context.Context, msg *Message) (*Result, error) {
+	contentType := msg.ContentType
 	if contentType == "" {
-		contentType = "application/json"
-	}
-	eventType := event.GetType()
-	payload := event.GetPayLoad()
-	if strings.Index(contentType, "application/json") == 0 {
-		if payload != nil {
-			data, err = json.Marshal(payload)
-			if err != nil {
-				return nil, err
-			}
-		}
-	} else if strings.Index(contentType, "application/xml") == 0 {
-		if payload != nil {
-			data, err = xml.Marshal(payload)
-			if err != nil {
-				return nil, err
-			}
-		}
+		contentType = DefaultContentType
 	}
-
 	var r io.Reader
-	if len(data) > 0 {
-		r = bytes.NewReader(data)
+	if len(msg.Body) > 0 {
+		r = bytes.NewReader(msg.Body)
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, r)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msg.Url, r)
 	if err != nil {
 		return nil, err
 	}
 
+	for k, v := range msg.Header {
+		req.Header[k] = v
+	}
 	req.Header.Set("Content-Type", contentType)
-	req.Header.Set(EventTypeHeader, eventType)
-	req.Header.Set(EventSignatureHeader, secretSign)
+	req.Header.Set(EventTypeHeader, msg.EventType)
+	if msg.Signature != "" {
+		req.Header.Set(EventSignatureHeader, msg.Signature)
+		req.Header.Set(WebhookSignatureHeader, msg.Signature)
+	}
+	if msg.ID != "" {
+		req.Header.Set(DeliveryIDHeader, msg.ID)
+		req.Header.Set(WebhookIDHeader, msg.ID)
+	}
+	if !msg.Timestamp.IsZero() {
+		req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(msg.Timestamp.Unix(), 10))
+	}
+	if msg.Auth != nil {
+		if err := msg.Auth.Apply(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+	ret := &Result{
+		RequestHeader: redact(req.Header),
+	}
+	start := time.Now()
 	resp, err := n.client.Do(req)
 	if err != nil {
-		return nil, err
+		ret.Latency = time.Since(start)
+		return ret, err
 	}
 	defer resp.Body.Close()
 	d, _ := ioutil.ReadAll(resp.Body)
+	ret.Latency = time.Since(start)
+	ret.StatusCode = resp.StatusCode
+	ret.Header = resp.Header
+	ret.Body = d
 
+	if resp.StatusCode == http.StatusUnauthorized {
+		if v, ok := msg.Auth.(Invalidator); ok {
+			v.Invalidate()
+		}
+	}
 	if resp.StatusCode >= 400 {
-		err = fmt.Errorf("Notify to URL %s failed, http status: %d ", url, resp.StatusCode)
+		err = &ResponseError{
+			Url:        msg.Url,
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			Body:       d,
+		}
 
 		respStr := ""
 		if len(d) > 0 {
 			respStr = string(d)
 		}
 		n.logger.Errorf("Notify error: %v, response data: %s \n", err, respStr)
-		return nil, err
+		return ret, err
+	}
+	return ret, nil
+}
+
+// redact hides credentials in the header, which may be logged.
+func redact(header http.Header) http.Header {
+	if header.Get("Authorization") == "" {
+		return header
+	}
+	ret := header.Clone()
+	ret.Set("Authorization", "******")
+	return ret
+}
+
+// Marshal serializes payload according to contentType.
+func Marshal(contentType string, payload interface{}) ([]byte, error) {
+	if payload == nil {
+		return nil, nil
+	}
+	if contentType == "" {
+		contentType = DefaultContentType
+	}
+	if strings.Index(contentType, "application/json") == 0 {
+		return json.Marshal(payload)
+	} else if strings.Index(contentType, "application/xml") == 0 {
+		return xml.Marshal(payload)
 	}
-	return d, nil
+	return nil, nil
 }
@@ -0,0 +1,58 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notifier
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestResponseError(t *testing.T) {
+	now := time.Now()
+	e := &ResponseError{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	e.Header.Set("Retry-After", "120")
+	if d, ok := e.RetryAfter(now); !ok || d != 2*time.Minute {
+		t.Fatalf("Expect 2m but get %v\n", d)
+	}
+	e.StatusCode = http.StatusServiceUnavailable
+	e.Header.Set("Retry-After", now.Add(time.Hour).UTC().Format(http.TimeFormat))
+	if d, ok := e.RetryAfter(now); !ok || d < 59*time.Minute || d > time.Hour {
+		t.Fatalf("Expect about 1h but get %v\n", d)
+	}
+	if e.Permanent() {
+		t.Fatal("Expect 503 not permanent")
+	}
+
+	e.StatusCode = http.StatusInternalServerError
+	if _, ok := e.RetryAfter(now); ok {
+		t.Fatal("Expect Retry-After ignored on 500")
+	}
+	for _, code := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound} {
+		e.StatusCode = code
+		if !e.Permanent() {
+			t.Fatalf("Expect %d permanent\n", code)
+		}
+	}
+	for _, code := range []int{http.StatusRequestTimeout, http.StatusTooManyRequests} {
+		e.StatusCode = code
+		if e.Permanent() {
+			t.Fatalf("Expect %d not permanent\n", code)
+		}
+	}
+}
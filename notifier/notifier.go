@@ -19,9 +19,38 @@ package notifier
 
 import (
 	"context"
-	"github.com/xfali/neve-webhook/events"
+	"net/http"
+	"time"
 )
 
+// Message is a serialized event to be sent to a webhook.
+type Message struct {
+	// Delivery id
+	ID          string
+	Url         string
+	ContentType string
+	EventType   string
+	// Time of signing
+	Timestamp time.Time
+	// Signature in webhook-signature header, empty if it is in Header
+	Signature string
+	// Extra headers, e.g. signature headers
+	Header http.Header
+	// Credentials of the webhook, nil if it needs no authentication
+	Auth Credentials
+	Body []byte
+}
+
+// Result is what happened on the wire of a sending.
+type Result struct {
+	RequestHeader http.Header
+	StatusCode    int
+	Header        http.Header
+	Body          []byte
+	Latency       time.Duration
+}
+
 type Notifier interface {
-	Send(ctx context.Context, url string, contentType string, secret string, event events.IEvent) ([]byte, error)
+	// Send sends the message, the result is returned whenever the webhook responded, even if err is not nil.
+	Send(ctx context.Context, msg *Message) (*Result, error)
 }
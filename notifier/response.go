@@ -17,8 +17,16 @@
 
 package notifier
 
+import "time"
+
 type Response struct {
-	Url     string
-	Payload interface{}
-	Error   error
+	WebhookID  string
+	Url        string
+	DeliveryID string
+	Attempts   int
+	StatusCode int
+	Latency    time.Duration
+	Body       []byte
+	Payload    interface{}
+	Error      error
 }
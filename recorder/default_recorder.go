@@ -21,6 +21,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/xfali/goutils/container/xmap"
+	"github.com/xfali/neve-webhook/auth"
 	"strconv"
 	"sync"
 	"time"
@@ -28,12 +29,15 @@ import (
 
 type Opt func(r *simpleRecorder)
 
+type MemOpt func(r *memRecorder)
+
 type memRecorder struct {
 	locker      sync.RWMutex
 	idGenerator IdGenerator
 	eventMap    map[string]*xmap.LinkedMap
 	urlMap      map[string]string
 	idMap       *xmap.LinkedMap
+	sealer      auth.SecretSealer
 }
 
 type ContextFilter interface {
@@ -50,20 +54,26 @@ func NewSingleMemFilter() *singleFilter {
 	}
 }
 
-func NewSimpleRecorder() *simpleRecorder {
+func NewSimpleRecorder(opts ...Opt) *simpleRecorder {
 	ret := &simpleRecorder{
 		filter: NewSingleMemFilter(),
 	}
+	for _, opt := range opts {
+		opt(ret)
+	}
 	return ret
 }
 
-func NewMemRecorder() *memRecorder {
+func NewMemRecorder(opts ...MemOpt) *memRecorder {
 	ret := &memRecorder{
 		eventMap:    map[string]*xmap.LinkedMap{},
 		idMap:       xmap.NewLinkedMap(),
 		urlMap:      map[string]string{},
 		idGenerator: NewIdGenerator(),
 	}
+	for _, opt := range opts {
+		opt(ret)
+	}
 	return ret
 }
 
@@ -83,12 +93,26 @@ func (r *memRecorder) Create(ctx context.Context, input Input) (string, error) {
 		return "", fmt.Errorf("Url have been exists ")
 	}
 
+	secret, err := seal(r.sealer, input.Secret)
+	if err != nil {
+		return "", err
+	}
+	outboundAuth, err := sealAuth(r.sealer, input.OutboundAuth)
+	if err != nil {
+		return "", err
+	}
 	id := r.idGenerator.Next()
 	idStr := strconv.FormatInt(id, 10)
 
 	data := input.ToData()
+	data.Secret = secret
+	data.OutboundAuth = outboundAuth
 	data.ID = idStr
-	data.State = HookStateNormal
+	// webhooks start normal unless they need verification
+	if data.State != HookStatePendingVerification {
+		data.State = HookStateNormal
+		data.VerificationToken = ""
+	}
 	r.idMap.Put(idStr, &data)
 	r.urlMap[data.Url] = idStr
 	for _, e := range data.TriggerEventTypes {
@@ -109,6 +133,15 @@ func (r *memRecorder) Update(ctx context.Context, idStr string, data Input) erro
 	r.locker.Lock()
 	defer r.locker.Unlock()
 
+	secret, err := seal(r.sealer, data.Secret)
+	if err != nil {
+		return err
+	}
+	outboundAuth, err := sealAuth(r.sealer, data.OutboundAuth)
+	if err != nil {
+		return err
+	}
+
 	if x, ok := r.idMap.Get(idStr); ok {
 		v := x.(*Data)
 		for _, e := range v.TriggerEventTypes {
@@ -121,16 +154,26 @@ func (r *memRecorder) Update(ctx context.Context, idStr string, data Input) erro
 			}
 			v.Url = data.Url
 		}
-		if data.Secret != "" {
-			v.Secret = data.Secret
+		if secret != "" {
+			v.Secret = secret
 		}
 		if data.ContentType != "" {
 			v.ContentType = data.ContentType
 		}
+		if data.SignatureProfile != "" {
+			v.SignatureProfile = data.SignatureProfile
+		}
+		if data.OutboundAuth != nil {
+			v.OutboundAuth = outboundAuth
+		}
 		if data.State != "" {
 			v.State = data.State
+			v.StateReason = data.StateReason
+			v.VerificationToken = data.VerificationToken
 		}
 		v.TriggerEventTypes = data.TriggerEventTypes
+		v.RateLimit = data.RateLimit
+		v.RateBurst = data.RateBurst
 	} else {
 		return fmt.Errorf("ID %s not found ", idStr)
 	}
@@ -168,6 +211,26 @@ func (r *memRecorder) UpdateNotifyStatus(ctx context.Context, id string, updateT
 	return nil
 }
 
+func (r *memRecorder) RotateSecret(ctx context.Context, id string, secret string, previousExpire time.Time) error {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	secret, err := seal(r.sealer, secret)
+	if err != nil {
+		return err
+	}
+
+	if x, ok := r.idMap.Get(id); ok {
+		v := x.(*Data)
+		v.PreviousSecret = v.Secret
+		v.PreviousSecretExpire = previousExpire
+		v.Secret = secret
+	} else {
+		return fmt.Errorf("ID %s not found ", id)
+	}
+	return nil
+}
+
 func (r *memRecorder) Delete(ctx context.Context, id string) error {
 	r.locker.Lock()
 	defer r.locker.Unlock()
@@ -183,7 +246,69 @@ func (r *memRecorder) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
+// seal returns the secret to store, empty secret is not sealed.
+func seal(sealer auth.SecretSealer, secret string) (string, error) {
+	if sealer == nil || secret == "" {
+		return secret, nil
+	}
+	return sealer.Seal(secret)
+}
+
+// sealAuth returns a copy of the authentication to store, nil if it is removed.
+func sealAuth(sealer auth.SecretSealer, a *OutboundAuth) (*OutboundAuth, error) {
+	if a == nil || a.Type == OutboundAuthNone {
+		return nil, nil
+	}
+	ret := *a
+	var err error
+	for _, v := range []*string{&ret.Password, &ret.Token, &ret.ClientSecret} {
+		if *v, err = seal(sealer, *v); err != nil {
+			return nil, err
+		}
+	}
+	return &ret, nil
+}
+
+// open returns data with opened secrets.
+func open(sealer auth.SecretSealer, datas []Data) ([]Data, error) {
+	if sealer == nil {
+		return datas, nil
+	}
+	var err error
+	for i := range datas {
+		if datas[i].Secret, err = sealer.Open(datas[i].Secret); err != nil {
+			return nil, err
+		}
+		if datas[i].PreviousSecret != "" {
+			if datas[i].PreviousSecret, err = sealer.Open(datas[i].PreviousSecret); err != nil {
+				return nil, err
+			}
+		}
+		if datas[i].OutboundAuth != nil {
+			a := *datas[i].OutboundAuth
+			for _, v := range []*string{&a.Password, &a.Token, &a.ClientSecret} {
+				if *v != "" {
+					if *v, err = sealer.Open(*v); err != nil {
+						return nil, err
+					}
+				}
+			}
+			datas[i].OutboundAuth = &a
+		}
+	}
+	return datas, nil
+}
+
 func (r *memRecorder) Query(ctx context.Context, condition QueryCondition) ([]Data, int64, error) {
+	ret, total, err := r.query(ctx, condition)
+	if err != nil {
+		return ret, total, err
+	}
+	ret, err = open(r.sealer, ret)
+	return ret, total, err
+}
+
+func (r *memRecorder) query(ctx context.Context, condition QueryCondition) ([]Data, int64, error) {
 	r.locker.RLock()
 	defer r.locker.RUnlock()
 
@@ -312,6 +437,14 @@ func (r *simpleRecorder) Update(ctx context.Context, id string, data Input) erro
 	return rr.Update(ctx, id, data)
 }
 
+func (r *simpleRecorder) RotateSecret(ctx context.Context, id string, secret string, previousExpire time.Time) error {
+	rr, err := r.filter.Filter(ctx)
+	if err != nil {
+		return err
+	}
+	return rr.RotateSecret(ctx, id, secret, previousExpire)
+}
+
 func (r *simpleRecorder) UpdateNotifyStatus(ctx context.Context, id string, updateTime time.Time, success bool) error {
 	rr, err := r.filter.Filter(ctx)
 	if err != nil {
@@ -332,6 +465,24 @@ type opts struct{}
 
 var Opts opts
 
+type memOpts struct{}
+
+var MemOpts memOpts
+
+// SetSecretSealer seals secrets of webhooks at rest, nil to store them in plaintext.
+func (o memOpts) SetSecretSealer(s auth.SecretSealer) MemOpt {
+	return func(r *memRecorder) {
+		r.sealer = s
+	}
+}
+
+// SetIdGenerator sets the generator of ids, recorders sharing one generator never create the same id.
+func (o memOpts) SetIdGenerator(g IdGenerator) MemOpt {
+	return func(r *memRecorder) {
+		r.idGenerator = g
+	}
+}
+
 func (o opts) SetFilter(f ContextFilter) Opt {
 	return func(r *simpleRecorder) {
 		r.filter = f
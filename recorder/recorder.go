@@ -19,6 +19,7 @@ package recorder
 
 import (
 	"context"
+	"fmt"
 	"time"
 )
 
@@ -26,19 +27,35 @@ const (
 	HookStateNormal    = "normal"
 	HookStateAbnormal  = "abnormal"
 	HookStateForbidden = "forbidden"
+	// Webhook is created but its endpoint has not answered the challenge token
+	HookStatePendingVerification = "pending_verification"
 )
 
 type Data struct {
-	ID                string    `json:"id" xml:"id" yaml:"id"`
-	Url               string    `json:"url" xml:"url" yaml:"url"`
-	ContentType       string    `json:"content_type" xml:"content_type" yaml:"content_type"`
-	Secret            string    `json:"secret" xml:"secret" yaml:"secret"`
-	TriggerEventTypes []string  `json:"event_type" xml:"event_type" yaml:"event_type"`
-	State             string    `json:"state" xml:"state" yaml:"state"`
-	FailureCount      int64     `json:"failure_count" xml:"failure_count" yaml:"failure_count"`
-	SuccessCount      int64     `json:"success_count" xml:"success_count" yaml:"success_count"`
-	LastFailureTime   time.Time `json:"last_failure_time" xml:"last_failure_time" yaml:"last_failure_time"`
-	LastSuccessTime   time.Time `json:"last_success_time" xml:"last_success_time" yaml:"last_success_time"`
+	ID          string `json:"id" xml:"id" yaml:"id"`
+	Url         string `json:"url" xml:"url" yaml:"url"`
+	ContentType string `json:"content_type" xml:"content_type" yaml:"content_type"`
+	Secret      string `json:"secret" xml:"secret" yaml:"secret"`
+	// Secret replaced by rotation, still valid until PreviousSecretExpire
+	PreviousSecret       string    `json:"previous_secret,omitempty" xml:"previous_secret,omitempty" yaml:"previous_secret,omitempty"`
+	PreviousSecretExpire time.Time `json:"previous_secret_expire,omitempty" xml:"previous_secret_expire,omitempty" yaml:"previous_secret_expire,omitempty"`
+	TriggerEventTypes    []string  `json:"event_type" xml:"event_type" yaml:"event_type"`
+	State                string    `json:"state" xml:"state" yaml:"state"`
+	StateReason          string    `json:"state_reason" xml:"state_reason" yaml:"state_reason"`
+	FailureCount         int64     `json:"failure_count" xml:"failure_count" yaml:"failure_count"`
+	SuccessCount         int64     `json:"success_count" xml:"success_count" yaml:"success_count"`
+	LastFailureTime      time.Time `json:"last_failure_time" xml:"last_failure_time" yaml:"last_failure_time"`
+	LastSuccessTime      time.Time `json:"last_success_time" xml:"last_success_time" yaml:"last_success_time"`
+	// Max deliveries per second, 0 means no limit.
+	RateLimit float64 `json:"rate_limit" xml:"rate_limit" yaml:"rate_limit"`
+	// Max deliveries at once after idle, at least 1.
+	RateBurst int `json:"rate_burst" xml:"rate_burst" yaml:"rate_burst"`
+	// Signature profile of deliveries, e.g. standard, rfc9421, empty means the default signer.
+	SignatureProfile string `json:"signature_profile" xml:"signature_profile" yaml:"signature_profile"`
+	// Authentication of deliveries, nil means no authentication.
+	OutboundAuth *OutboundAuth `json:"outbound_auth,omitempty" xml:"outbound_auth,omitempty" yaml:"outbound_auth,omitempty"`
+	// Challenge token while the webhook is pending verification, never responded.
+	VerificationToken string `json:"-" xml:"-" yaml:"-"`
 }
 
 type Input struct {
@@ -47,6 +64,68 @@ type Input struct {
 	Secret            string   `json:"secret" xml:"secret" yaml:"secret"`
 	TriggerEventTypes []string `json:"event_type" xml:"event_type" yaml:"event_type"`
 	State             string   `json:"state" xml:"state" yaml:"state"`
+	StateReason       string   `json:"state_reason" xml:"state_reason" yaml:"state_reason"`
+	RateLimit         float64  `json:"rate_limit" xml:"rate_limit" yaml:"rate_limit"`
+	RateBurst         int      `json:"rate_burst" xml:"rate_burst" yaml:"rate_burst"`
+	SignatureProfile  string   `json:"signature_profile" xml:"signature_profile" yaml:"signature_profile"`
+	// Nil means unchanged when updating, type none removes the authentication.
+	OutboundAuth *OutboundAuth `json:"outbound_auth,omitempty" xml:"outbound_auth,omitempty" yaml:"outbound_auth,omitempty"`
+	// Set by the server together with State
+	VerificationToken string `json:"-" xml:"-" yaml:"-"`
+}
+
+const (
+	OutboundAuthNone   = "none"
+	OutboundAuthBasic  = "basic"
+	OutboundAuthBearer = "bearer"
+	// OAuth2 client credentials grant
+	OutboundAuthOAuth2 = "oauth2"
+)
+
+// OutboundAuth is the authentication of requests to the webhook.
+// Password, Token and ClientSecret are protected like secrets.
+type OutboundAuth struct {
+	Type string `json:"type" xml:"type" yaml:"type"`
+
+	Username string `json:"username,omitempty" xml:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" xml:"password,omitempty" yaml:"password,omitempty"`
+
+	Token string `json:"token,omitempty" xml:"token,omitempty" yaml:"token,omitempty"`
+
+	TokenUrl     string   `json:"token_url,omitempty" xml:"token_url,omitempty" yaml:"token_url,omitempty"`
+	ClientID     string   `json:"client_id,omitempty" xml:"client_id,omitempty" yaml:"client_id,omitempty"`
+	ClientSecret string   `json:"client_secret,omitempty" xml:"client_secret,omitempty" yaml:"client_secret,omitempty"`
+	Scopes       []string `json:"scopes,omitempty" xml:"scopes,omitempty" yaml:"scopes,omitempty"`
+}
+
+func (a *OutboundAuth) Validate() error {
+	switch a.Type {
+	case OutboundAuthNone:
+	case OutboundAuthBasic:
+		if a.Username == "" {
+			return fmt.Errorf("Username of basic auth cannot be empty ")
+		}
+	case OutboundAuthBearer:
+		if a.Token == "" {
+			return fmt.Errorf("Bearer token cannot be empty ")
+		}
+	case OutboundAuthOAuth2:
+		if a.TokenUrl == "" || a.ClientID == "" {
+			return fmt.Errorf("Token url and client id of oauth2 cannot be empty ")
+		}
+	default:
+		return fmt.Errorf("Unknown outbound auth type %s ", a.Type)
+	}
+	return nil
+}
+
+// Secrets returns valid secrets at now, the current one first.
+func (d *Data) Secrets(now time.Time) []string {
+	ret := []string{d.Secret}
+	if d.PreviousSecret != "" && now.Before(d.PreviousSecretExpire) {
+		ret = append(ret, d.PreviousSecret)
+	}
+	return ret
 }
 
 func (i *Input) ToData() Data {
@@ -56,6 +135,12 @@ func (i *Input) ToData() Data {
 		Secret:            i.Secret,
 		TriggerEventTypes: i.TriggerEventTypes,
 		State:             i.State,
+		StateReason:       i.StateReason,
+		RateLimit:         i.RateLimit,
+		RateBurst:         i.RateBurst,
+		SignatureProfile:  i.SignatureProfile,
+		OutboundAuth:      i.OutboundAuth,
+		VerificationToken: i.VerificationToken,
 	}
 }
 
@@ -80,5 +165,8 @@ type Recorder interface {
 
 	UpdateNotifyStatus(ctx context.Context, id string, updateTime time.Time, success bool) error
 
+	// RotateSecret replaces the secret, the current one is kept valid until previousExpire.
+	RotateSecret(ctx context.Context, id string, secret string, previousExpire time.Time) error
+
 	Delete(ctx context.Context, id string) error
 }
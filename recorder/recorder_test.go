@@ -19,7 +19,10 @@ package recorder
 
 import (
 	"context"
+	"errors"
+	"github.com/xfali/neve-webhook/auth"
 	"testing"
+	"time"
 )
 
 func TestRecorder1(t *testing.T) {
@@ -219,3 +222,130 @@ func TestRecorder2(t *testing.T) {
 		t.Fatalf("Expect test3 but get %s\n", v[0].Url)
 	}
 }
+
+func TestRotateSecret(t *testing.T) {
+	r := NewMemRecorder()
+	ctx := context.Background()
+	id, err := r.Create(ctx, Input{
+		Url:    "test",
+		Secret: "old",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	err = r.RotateSecret(ctx, id, "new", now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _, _ := r.Query(ctx, QueryCondition{
+		Id: id,
+	})
+	secrets := v[0].Secrets(now)
+	if len(secrets) != 2 || secrets[0] != "new" || secrets[1] != "old" {
+		t.Fatalf("Expect [new old] but get %v\n", secrets)
+	}
+	secrets = v[0].Secrets(now.Add(2 * time.Minute))
+	if len(secrets) != 1 || secrets[0] != "new" {
+		t.Fatalf("Expect [new] but get %v\n", secrets)
+	}
+}
+
+func TestSecretSealer(t *testing.T) {
+	keyring := auth.NewHmacKeyring()
+	if err := keyring.Generate("k1"); err != nil {
+		t.Fatal(err)
+	}
+	r := NewMemRecorder(MemOpts.SetSecretSealer(auth.NewAesGcmSealer(keyring)))
+	ctx := context.Background()
+	id, err := r.Create(ctx, Input{
+		Url:          "http://localhost/test",
+		Secret:       "test-secret",
+		OutboundAuth: &OutboundAuth{Type: OutboundAuthBearer, Token: "test-token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, _ := r.idMap.Get(id)
+	if !auth.IsSealed(x.(*Data).Secret) || !auth.IsSealed(x.(*Data).OutboundAuth.Token) {
+		t.Fatalf("Expect sealed but get %s %s\n", x.(*Data).Secret, x.(*Data).OutboundAuth.Token)
+	}
+
+	// rotate the key, secrets sealed by the retired key still can be opened
+	if err := keyring.Generate("k2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.SetActive("k2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Retire("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RotateSecret(ctx, id, "new-secret", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	v, _, err := r.Query(ctx, QueryCondition{Id: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v[0].Secret != "new-secret" || v[0].PreviousSecret != "test-secret" {
+		t.Fatalf("Expect opened secrets but get %s %s\n", v[0].Secret, v[0].PreviousSecret)
+	}
+	if v[0].OutboundAuth.Token != "test-token" {
+		t.Fatalf("Expect opened token but get %s\n", v[0].OutboundAuth.Token)
+	}
+
+	// secrets looking sealed are sealed as well
+	id, err = r.Create(ctx, Input{Url: "http://localhost/sealed", Secret: "sealed:test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _, err = r.Query(ctx, QueryCondition{Id: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v[0].Secret != "sealed:test" {
+		t.Fatalf("Expect sealed:test but get %s\n", v[0].Secret)
+	}
+}
+
+func TestTenantFilter(t *testing.T) {
+	r := NewSimpleRecorder(Opts.SetFilter(NewTenantFilter(NewMemRecorderFactory(), TenantOpts.SetCapacity(2))))
+	ctxA := WithTenant(context.Background(), "a")
+	ctxB := WithTenant(context.Background(), "b")
+	if _, err := r.Create(context.Background(), Input{Url: "http://localhost/test"}); !errors.Is(err, NoTenantErr) {
+		t.Fatalf("Expect NoTenantErr but get %v\n", err)
+	}
+	idA, err := r.Create(ctxA, Input{Url: "http://localhost/test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// same url of another tenant
+	idB, err := r.Create(ctxB, Input{Url: "http://localhost/test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idA == idB {
+		t.Fatalf("Expect unique ids but get %s\n", idA)
+	}
+	v, total, err := r.Query(ctxA, QueryCondition{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || v[0].ID != idA {
+		t.Fatalf("Expect only %s but get %v\n", idA, v)
+	}
+	_ = r.Delete(ctxB, idA)
+	if v, _, _ := r.Query(ctxA, QueryCondition{Id: idA}); len(v) != 1 {
+		t.Fatal("Expect webhook not deleted by other tenant")
+	}
+
+	// the least recently used tenant is evicted
+	if _, _, err := r.Query(WithTenant(context.Background(), "c"), QueryCondition{}); err != nil {
+		t.Fatal(err)
+	}
+	tenants := r.filter.(*tenantFilter).Tenants()
+	if len(tenants) != 2 || tenants[0] != "c" || tenants[1] != "a" {
+		t.Fatalf("Expect [c a] but get %v\n", tenants)
+	}
+}
@@ -0,0 +1,215 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package recorder
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+)
+
+const (
+	DialectSqlite   = "sqlite"
+	DialectMysql    = "mysql"
+	DialectPostgres = "postgres"
+)
+
+// Dialect adapts the sql recorder to a database.
+type Dialect interface {
+	// Placeholder returns the placeholder of the nth argument, n starts with 1.
+	Placeholder(n int) string
+
+	// Migrations returns statements of each version of the schema in order, the version starts with 1.
+	// Released versions must not be changed, add a new one instead.
+	// Statements must be idempotent, e.g. CREATE TABLE IF NOT EXISTS: DDL is not transactional in MySQL,
+	// a failed version may leave part of it applied, and instances starting together may apply a version twice.
+	Migrations() [][]string
+
+	// Insert executes the insert statement and returns the generated id.
+	Insert(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (int64, error)
+}
+
+// NewDialect returns the dialect of the name, e.g. DialectSqlite, DialectMysql and DialectPostgres.
+func NewDialect(name string) (Dialect, error) {
+	switch name {
+	case DialectSqlite:
+		return NewSqliteDialect(), nil
+	case DialectMysql:
+		return NewMysqlDialect(), nil
+	case DialectPostgres:
+		return NewPostgresDialect(), nil
+	}
+	return nil, fmt.Errorf("Unknown sql dialect %s ", name)
+}
+
+// sqliteDialect allows one writer at a time, set busy_timeout of the database
+// or limit open connections of sql.DB to 1 for concurrent updates.
+type sqliteDialect struct{}
+
+func NewSqliteDialect() *sqliteDialect {
+	return &sqliteDialect{}
+}
+
+func (d *sqliteDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (d *sqliteDialect) Migrations() [][]string {
+	return [][]string{
+		{
+			`CREATE TABLE IF NOT EXISTS webhooks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	url TEXT NOT NULL UNIQUE,
+	content_type TEXT NOT NULL DEFAULT '',
+	secret TEXT NOT NULL DEFAULT '',
+	previous_secret TEXT NOT NULL DEFAULT '',
+	previous_secret_expire INTEGER NOT NULL DEFAULT 0,
+	state TEXT NOT NULL DEFAULT '',
+	state_reason TEXT NOT NULL DEFAULT '',
+	failure_count INTEGER NOT NULL DEFAULT 0,
+	success_count INTEGER NOT NULL DEFAULT 0,
+	last_failure_time INTEGER NOT NULL DEFAULT 0,
+	last_success_time INTEGER NOT NULL DEFAULT 0,
+	rate_limit REAL NOT NULL DEFAULT 0,
+	rate_burst INTEGER NOT NULL DEFAULT 0,
+	signature_profile TEXT NOT NULL DEFAULT '',
+	outbound_auth TEXT,
+	verification_token TEXT NOT NULL DEFAULT ''
+)`,
+			`CREATE TABLE IF NOT EXISTS webhook_event_types (
+	webhook_id INTEGER NOT NULL,
+	event_type TEXT NOT NULL,
+	PRIMARY KEY (webhook_id, event_type)
+)`,
+			`CREATE INDEX IF NOT EXISTS idx_webhook_event_types_event_type ON webhook_event_types (event_type, webhook_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_webhooks_state ON webhooks (state)`,
+		},
+	}
+}
+
+func (d *sqliteDialect) Insert(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (int64, error) {
+	return insertLastId(ctx, tx, query, args...)
+}
+
+type mysqlDialect struct{}
+
+func NewMysqlDialect() *mysqlDialect {
+	return &mysqlDialect{}
+}
+
+func (d *mysqlDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (d *mysqlDialect) Migrations() [][]string {
+	return [][]string{
+		{
+			// url is limited to 768 characters to be indexed in utf8mb4
+			`CREATE TABLE IF NOT EXISTS webhooks (
+	id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	url VARCHAR(768) NOT NULL,
+	content_type VARCHAR(255) NOT NULL DEFAULT '',
+	secret TEXT NOT NULL,
+	previous_secret TEXT NOT NULL,
+	previous_secret_expire BIGINT NOT NULL DEFAULT 0,
+	state VARCHAR(32) NOT NULL DEFAULT '',
+	state_reason TEXT NOT NULL,
+	failure_count BIGINT NOT NULL DEFAULT 0,
+	success_count BIGINT NOT NULL DEFAULT 0,
+	last_failure_time BIGINT NOT NULL DEFAULT 0,
+	last_success_time BIGINT NOT NULL DEFAULT 0,
+	rate_limit DOUBLE NOT NULL DEFAULT 0,
+	rate_burst INT NOT NULL DEFAULT 0,
+	signature_profile VARCHAR(64) NOT NULL DEFAULT '',
+	outbound_auth TEXT,
+	verification_token VARCHAR(255) NOT NULL DEFAULT '',
+	UNIQUE KEY uk_webhooks_url (url),
+	KEY idx_webhooks_state (state)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			`CREATE TABLE IF NOT EXISTS webhook_event_types (
+	webhook_id BIGINT NOT NULL,
+	event_type VARCHAR(255) NOT NULL,
+	PRIMARY KEY (webhook_id, event_type),
+	KEY idx_webhook_event_types_event_type (event_type, webhook_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+		},
+	}
+}
+
+func (d *mysqlDialect) Insert(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (int64, error) {
+	return insertLastId(ctx, tx, query, args...)
+}
+
+type postgresDialect struct{}
+
+func NewPostgresDialect() *postgresDialect {
+	return &postgresDialect{}
+}
+
+func (d *postgresDialect) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func (d *postgresDialect) Migrations() [][]string {
+	return [][]string{
+		{
+			`CREATE TABLE IF NOT EXISTS webhooks (
+	id BIGSERIAL PRIMARY KEY,
+	url TEXT NOT NULL UNIQUE,
+	content_type TEXT NOT NULL DEFAULT '',
+	secret TEXT NOT NULL DEFAULT '',
+	previous_secret TEXT NOT NULL DEFAULT '',
+	previous_secret_expire BIGINT NOT NULL DEFAULT 0,
+	state VARCHAR(32) NOT NULL DEFAULT '',
+	state_reason TEXT NOT NULL DEFAULT '',
+	failure_count BIGINT NOT NULL DEFAULT 0,
+	success_count BIGINT NOT NULL DEFAULT 0,
+	last_failure_time BIGINT NOT NULL DEFAULT 0,
+	last_success_time BIGINT NOT NULL DEFAULT 0,
+	rate_limit DOUBLE PRECISION NOT NULL DEFAULT 0,
+	rate_burst INTEGER NOT NULL DEFAULT 0,
+	signature_profile VARCHAR(64) NOT NULL DEFAULT '',
+	outbound_auth TEXT,
+	verification_token VARCHAR(255) NOT NULL DEFAULT ''
+)`,
+			`CREATE TABLE IF NOT EXISTS webhook_event_types (
+	webhook_id BIGINT NOT NULL,
+	event_type VARCHAR(255) NOT NULL,
+	PRIMARY KEY (webhook_id, event_type)
+)`,
+			`CREATE INDEX IF NOT EXISTS idx_webhook_event_types_event_type ON webhook_event_types (event_type, webhook_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_webhooks_state ON webhooks (state)`,
+		},
+	}
+}
+
+// Insert returns the id by RETURNING, postgres does not support LastInsertId.
+func (d *postgresDialect) Insert(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (int64, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
+
+func insertLastId(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (int64, error) {
+	ret, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return ret.LastInsertId()
+}
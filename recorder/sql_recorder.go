@@ -0,0 +1,501 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package recorder
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/xfali/neve-webhook/auth"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const webhookColumns = "id, url, content_type, secret, previous_secret, previous_secret_expire, state, state_reason, " +
+	"failure_count, success_count, last_failure_time, last_success_time, rate_limit, rate_burst, " +
+	"signature_profile, outbound_auth, verification_token"
+
+type SqlOpt func(r *sqlRecorder)
+
+// sqlRecorder stores webhooks in a database by database/sql, the driver of the database is imported by users.
+// Event types are indexed in a join table, times are stored as unix nanoseconds and 0 means zero time.
+type sqlRecorder struct {
+	db      *sql.DB
+	dialect Dialect
+	sealer  auth.SecretSealer
+}
+
+// NewSqlRecorder creates recorder of the database, the schema is created by Migrate.
+func NewSqlRecorder(db *sql.DB, dialect Dialect, opts ...SqlOpt) *sqlRecorder {
+	ret := &sqlRecorder{
+		db:      db,
+		dialect: dialect,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+func (r *sqlRecorder) BeanAfterSet() error {
+	return r.Migrate(context.Background())
+}
+
+// Migrate applies migrations of the dialect which are not applied yet.
+// A version is applied again if it failed before, a version applied by another instance at the same time is accepted.
+func (r *sqlRecorder) Migrate(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS webhook_migrations (version INTEGER NOT NULL PRIMARY KEY)")
+	if err != nil {
+		return err
+	}
+	var current int
+	if err := r.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM webhook_migrations").Scan(&current); err != nil {
+		return err
+	}
+	for i, stmts := range r.dialect.Migrations() {
+		version := i + 1
+		if version <= current {
+			continue
+		}
+		err := r.tx(ctx, func(tx *sql.Tx) error {
+			for _, stmt := range stmts {
+				if _, err := tx.ExecContext(ctx, stmt); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, "INSERT INTO webhook_migrations (version) VALUES ("+r.dialect.Placeholder(1)+")", version)
+			return err
+		})
+		if err != nil {
+			if applied, checkErr := r.migrated(ctx, version); checkErr == nil && applied {
+				continue
+			}
+			return fmt.Errorf("Migrate schema to version %d failed: %w ", version, err)
+		}
+	}
+	return nil
+}
+
+func (r *sqlRecorder) migrated(ctx context.Context, version int) (bool, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM webhook_migrations WHERE version = "+r.dialect.Placeholder(1), version).Scan(&n)
+	return n > 0, err
+}
+
+func (r *sqlRecorder) Create(ctx context.Context, input Input) (string, error) {
+	if input.Url == "" {
+		return "", fmt.Errorf("Url cannot be empty ")
+	}
+	secret, err := seal(r.sealer, input.Secret)
+	if err != nil {
+		return "", err
+	}
+	outboundAuth, err := r.encodeAuth(input.OutboundAuth)
+	if err != nil {
+		return "", err
+	}
+	data := input.ToData()
+	// webhooks start normal unless they need verification
+	if data.State != HookStatePendingVerification {
+		data.State = HookStateNormal
+		data.VerificationToken = ""
+	}
+
+	var id int64
+	err = r.tx(ctx, func(tx *sql.Tx) error {
+		a := r.args()
+		var n int64
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM webhooks WHERE url = "+a.add(data.Url), a.values...).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("Url have been exists ")
+		}
+		a = r.args()
+		query := "INSERT INTO webhooks (url, content_type, secret, previous_secret, state, state_reason, " +
+			"rate_limit, rate_burst, signature_profile, outbound_auth, verification_token) VALUES (" +
+			strings.Join([]string{
+				a.add(data.Url),
+				a.add(data.ContentType),
+				a.add(secret),
+				a.add(""),
+				a.add(data.State),
+				a.add(data.StateReason),
+				a.add(data.RateLimit),
+				a.add(data.RateBurst),
+				a.add(data.SignatureProfile),
+				a.add(outboundAuth),
+				a.add(data.VerificationToken),
+			}, ", ") + ")"
+		id, err = r.dialect.Insert(ctx, tx, query, a.values...)
+		if err != nil {
+			return err
+		}
+		return r.insertEventTypes(ctx, tx, id, data.TriggerEventTypes)
+	})
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(id, 10), nil
+}
+
+func (r *sqlRecorder) Update(ctx context.Context, idStr string, data Input) error {
+	id, err := parseId(idStr)
+	if err != nil {
+		return err
+	}
+	secret, err := seal(r.sealer, data.Secret)
+	if err != nil {
+		return err
+	}
+	outboundAuth, err := r.encodeAuth(data.OutboundAuth)
+	if err != nil {
+		return err
+	}
+
+	a := r.args()
+	sets := []string{
+		"rate_limit = " + a.add(data.RateLimit),
+		"rate_burst = " + a.add(data.RateBurst),
+	}
+	if data.Url != "" {
+		sets = append(sets, "url = "+a.add(data.Url))
+	}
+	if secret != "" {
+		sets = append(sets, "secret = "+a.add(secret))
+	}
+	if data.ContentType != "" {
+		sets = append(sets, "content_type = "+a.add(data.ContentType))
+	}
+	if data.SignatureProfile != "" {
+		sets = append(sets, "signature_profile = "+a.add(data.SignatureProfile))
+	}
+	if data.OutboundAuth != nil {
+		sets = append(sets, "outbound_auth = "+a.add(outboundAuth))
+	}
+	if data.State != "" {
+		sets = append(sets,
+			"state = "+a.add(data.State),
+			"state_reason = "+a.add(data.StateReason),
+			"verification_token = "+a.add(data.VerificationToken))
+	}
+	query := "UPDATE webhooks SET " + strings.Join(sets, ", ") + " WHERE id = " + a.add(id)
+	return r.tx(ctx, func(tx *sql.Tx) error {
+		if err := r.exists(ctx, tx, id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, query, a.values...); err != nil {
+			return err
+		}
+		if err := r.deleteEventTypes(ctx, tx, id); err != nil {
+			return err
+		}
+		return r.insertEventTypes(ctx, tx, id, data.TriggerEventTypes)
+	})
+}
+
+// UpdateNotifyStatus increases the counter in database, so that concurrent updates are not lost.
+func (r *sqlRecorder) UpdateNotifyStatus(ctx context.Context, idStr string, updateTime time.Time, success bool) error {
+	id, err := parseId(idStr)
+	if err != nil {
+		return err
+	}
+	count, last := "failure_count", "last_failure_time"
+	if success {
+		count, last = "success_count", "last_success_time"
+	}
+	a := r.args()
+	query := fmt.Sprintf("UPDATE webhooks SET %s = %s + 1, %s = %s WHERE id = %s", count, count, last, a.add(toNano(updateTime)), a.add(id))
+	ret, err := r.db.ExecContext(ctx, query, a.values...)
+	if err != nil {
+		return err
+	}
+	// the counter always changes, so no affected row means not found
+	n, err := ret.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("ID %s not found ", idStr)
+	}
+	return nil
+}
+
+func (r *sqlRecorder) RotateSecret(ctx context.Context, idStr string, secret string, previousExpire time.Time) error {
+	id, err := parseId(idStr)
+	if err != nil {
+		return err
+	}
+	secret, err = seal(r.sealer, secret)
+	if err != nil {
+		return err
+	}
+	a := r.args()
+	// previous_secret is assigned first, mysql assigns from left to right with updated values
+	query := "UPDATE webhooks SET previous_secret = secret, previous_secret_expire = " + a.add(toNano(previousExpire)) +
+		", secret = " + a.add(secret) + " WHERE id = " + a.add(id)
+	return r.tx(ctx, func(tx *sql.Tx) error {
+		if err := r.exists(ctx, tx, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, query, a.values...)
+		return err
+	})
+}
+
+func (r *sqlRecorder) Delete(ctx context.Context, idStr string) error {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil
+	}
+	return r.tx(ctx, func(tx *sql.Tx) error {
+		if err := r.deleteEventTypes(ctx, tx, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM webhooks WHERE id = "+r.dialect.Placeholder(1), id)
+		return err
+	})
+}
+
+func (r *sqlRecorder) Query(ctx context.Context, condition QueryCondition) ([]Data, int64, error) {
+	if condition.PageSize == 0 {
+		condition.PageSize = 20
+	}
+	a := r.args()
+	var where []string
+	if condition.Id != "" {
+		id, err := parseId(condition.Id)
+		if err != nil {
+			return nil, 0, err
+		}
+		where = append(where, "id = "+a.add(id))
+	}
+	if condition.Url != "" {
+		where = append(where, "url = "+a.add(condition.Url))
+	}
+	if condition.State != "" {
+		where = append(where, "state = "+a.add(condition.State))
+	}
+	if condition.EventType != "" {
+		where = append(where, "id IN (SELECT webhook_id FROM webhook_event_types WHERE event_type = "+a.add(condition.EventType)+")")
+	}
+	clause := ""
+	if len(where) > 0 {
+		clause = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM webhooks"+clause, a.values...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	if total == 0 {
+		if condition.Id != "" {
+			return nil, 0, fmt.Errorf("ID %s not found ", condition.Id)
+		}
+		if condition.Url != "" {
+			return nil, 0, fmt.Errorf("Url %s not found ", condition.Url)
+		}
+		return nil, 0, nil
+	}
+
+	query := "SELECT " + webhookColumns + " FROM webhooks" + clause + " ORDER BY id LIMIT " + a.add(condition.PageSize) +
+		" OFFSET " + a.add(condition.Offset*condition.PageSize)
+	rows, err := r.db.QueryContext(ctx, query, a.values...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var ret []Data
+	for rows.Next() {
+		d, err := r.scan(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		ret = append(ret, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if err := r.loadEventTypes(ctx, ret); err != nil {
+		return nil, 0, err
+	}
+	ret, err = open(r.sealer, ret)
+	return ret, total, err
+}
+
+func (r *sqlRecorder) scan(rows *sql.Rows) (Data, error) {
+	d := Data{}
+	var id, previousExpire, lastFailure, lastSuccess int64
+	var outboundAuth sql.NullString
+	err := rows.Scan(&id, &d.Url, &d.ContentType, &d.Secret, &d.PreviousSecret, &previousExpire, &d.State, &d.StateReason,
+		&d.FailureCount, &d.SuccessCount, &lastFailure, &lastSuccess, &d.RateLimit, &d.RateBurst,
+		&d.SignatureProfile, &outboundAuth, &d.VerificationToken)
+	if err != nil {
+		return d, err
+	}
+	d.ID = strconv.FormatInt(id, 10)
+	d.PreviousSecretExpire = fromNano(previousExpire)
+	d.LastFailureTime = fromNano(lastFailure)
+	d.LastSuccessTime = fromNano(lastSuccess)
+	if outboundAuth.Valid && outboundAuth.String != "" {
+		d.OutboundAuth = &OutboundAuth{}
+		if err := json.Unmarshal([]byte(outboundAuth.String), d.OutboundAuth); err != nil {
+			return d, err
+		}
+	}
+	return d, nil
+}
+
+func (r *sqlRecorder) loadEventTypes(ctx context.Context, datas []Data) error {
+	if len(datas) == 0 {
+		return nil
+	}
+	a := r.args()
+	index := make(map[int64]int, len(datas))
+	ids := make([]string, 0, len(datas))
+	for i := range datas {
+		id, _ := strconv.ParseInt(datas[i].ID, 10, 64)
+		index[id] = i
+		ids = append(ids, a.add(id))
+	}
+	rows, err := r.db.QueryContext(ctx, "SELECT webhook_id, event_type FROM webhook_event_types WHERE webhook_id IN ("+
+		strings.Join(ids, ", ")+") ORDER BY webhook_id, event_type", a.values...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var eventType string
+		if err := rows.Scan(&id, &eventType); err != nil {
+			return err
+		}
+		if i, ok := index[id]; ok {
+			datas[i].TriggerEventTypes = append(datas[i].TriggerEventTypes, eventType)
+		}
+	}
+	return rows.Err()
+}
+
+func (r *sqlRecorder) insertEventTypes(ctx context.Context, tx *sql.Tx, id int64, eventTypes []string) error {
+	query := "INSERT INTO webhook_event_types (webhook_id, event_type) VALUES (" + r.dialect.Placeholder(1) + ", " + r.dialect.Placeholder(2) + ")"
+	added := map[string]struct{}{}
+	for _, e := range eventTypes {
+		if _, ok := added[e]; ok {
+			continue
+		}
+		added[e] = struct{}{}
+		if _, err := tx.ExecContext(ctx, query, id, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *sqlRecorder) deleteEventTypes(ctx context.Context, tx *sql.Tx, id int64) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM webhook_event_types WHERE webhook_id = "+r.dialect.Placeholder(1), id)
+	return err
+}
+
+func (r *sqlRecorder) exists(ctx context.Context, tx *sql.Tx, id int64) error {
+	var n int64
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM webhooks WHERE id = "+r.dialect.Placeholder(1), id).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("ID %d not found ", id)
+	}
+	return nil
+}
+
+// encodeAuth returns the sealed authentication in json to store, null if it is removed.
+func (r *sqlRecorder) encodeAuth(a *OutboundAuth) (sql.NullString, error) {
+	sealed, err := sealAuth(r.sealer, a)
+	if err != nil || sealed == nil {
+		return sql.NullString{}, err
+	}
+	data, err := json.Marshal(sealed)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+func (r *sqlRecorder) tx(ctx context.Context, f func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlRecorder) args() *sqlArgs {
+	return &sqlArgs{
+		dialect: r.dialect,
+	}
+}
+
+// sqlArgs collects arguments of a statement and returns their placeholders.
+type sqlArgs struct {
+	dialect Dialect
+	values  []interface{}
+}
+
+func (a *sqlArgs) add(v interface{}) string {
+	a.values = append(a.values, v)
+	return a.dialect.Placeholder(len(a.values))
+}
+
+func parseId(idStr string) (int64, error) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("ID %s not found ", idStr)
+	}
+	return id, nil
+}
+
+func toNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+type sqlOpts struct{}
+
+var SqlOpts sqlOpts
+
+// SetSecretSealer seals secrets of webhooks at rest, nil to store them in plaintext.
+func (o sqlOpts) SetSecretSealer(s auth.SecretSealer) SqlOpt {
+	return func(r *sqlRecorder) {
+		r.sealer = s
+	}
+}
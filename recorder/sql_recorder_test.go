@@ -0,0 +1,159 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package recorder
+
+import (
+	"context"
+	"database/sql"
+	"github.com/xfali/neve-webhook/auth"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestSqlRecorder(t *testing.T) {
+	// writers wait for the lock instead of failing
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "webhooks.db")+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	keyring := auth.NewHmacKeyring()
+	if err := keyring.Generate("k1"); err != nil {
+		t.Fatal(err)
+	}
+	r := NewSqlRecorder(db, NewSqliteDialect(), SqlOpts.SetSecretSealer(auth.NewAesGcmSealer(keyring)))
+	ctx := context.Background()
+	if err := r.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// applied migrations are skipped
+	if err := r.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// a version partially applied before is applied again
+	if _, err := db.ExecContext(ctx, "DELETE FROM webhook_migrations"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "DROP INDEX idx_webhooks_state"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, url := range []string{"http://localhost/a", "http://localhost/b", "http://localhost/c"} {
+		id, err := r.Create(ctx, Input{
+			Url:               url,
+			Secret:            "test-secret",
+			TriggerEventTypes: []string{"push", "pull"},
+			OutboundAuth:      &OutboundAuth{Type: OutboundAuthBearer, Token: "test-token"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if _, err := r.Create(ctx, Input{Url: "http://localhost/a"}); err == nil {
+		t.Fatal("Expect error of duplicated url")
+	}
+	var secret string
+	if err := db.QueryRow("SELECT secret FROM webhooks WHERE id = ?", ids[0]).Scan(&secret); err != nil {
+		t.Fatal(err)
+	}
+	if !auth.IsSealed(secret) {
+		t.Fatalf("Expect sealed but get %s\n", secret)
+	}
+
+	err = r.Update(ctx, ids[1], Input{TriggerEventTypes: []string{"pull"}, State: HookStateAbnormal, StateReason: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, total, err := r.Query(ctx, QueryCondition{EventType: "push", State: HookStateNormal, PageSize: 1, Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(v) != 1 || v[0].ID != ids[2] {
+		t.Fatalf("Expect 2nd of 2 webhooks but get %d %v\n", total, v)
+	}
+	if v[0].Secret != "test-secret" || v[0].OutboundAuth.Token != "test-token" || len(v[0].TriggerEventTypes) != 2 {
+		t.Fatalf("Unexpected webhook: %+v\n", v[0])
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.UpdateNotifyStatus(ctx, ids[0], time.Now(), true); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := r.RotateSecret(ctx, ids[0], "new-secret", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	v, _, err = r.Query(ctx, QueryCondition{Id: ids[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v[0].SuccessCount != 10 || v[0].LastSuccessTime.IsZero() {
+		t.Fatalf("Expect 10 successes but get %d\n", v[0].SuccessCount)
+	}
+	if v[0].Secret != "new-secret" || v[0].PreviousSecret != "test-secret" {
+		t.Fatalf("Expect rotated secrets but get %s %s\n", v[0].Secret, v[0].PreviousSecret)
+	}
+
+	if err := r.Delete(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.Query(ctx, QueryCondition{Id: ids[0]}); err == nil {
+		t.Fatal("Expect error of deleted webhook")
+	}
+	if err := r.UpdateNotifyStatus(ctx, ids[0], time.Now(), false); err == nil {
+		t.Fatal("Expect error of deleted webhook")
+	}
+}
+
+func TestSqlRecorderConcurrentMigrate(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "webhooks.db")+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	r := NewSqlRecorder(db, &racingDialect{Dialect: NewSqliteDialect(), db: db})
+	if err := r.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// racingDialect lets another instance migrate after the current version is read.
+type racingDialect struct {
+	Dialect
+	db *sql.DB
+}
+
+func (d *racingDialect) Migrations() [][]string {
+	_ = NewSqlRecorder(d.db, d.Dialect).Migrate(context.Background())
+	return d.Dialect.Migrations()
+}
@@ -0,0 +1,214 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package recorder
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// TenantContextKey is the key of the tenant in context with string keys, e.g. gin.Context.
+const TenantContextKey = "neve.webhook.tenant"
+
+var NoTenantErr = errors.New("Tenant not found in context ")
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx carrying the tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFrom returns the tenant carried by ctx, which is set by WithTenant or as value of TenantContextKey.
+func TenantFrom(ctx context.Context) (string, bool) {
+	if v, ok := ctx.Value(tenantKey{}).(string); ok && v != "" {
+		return v, true
+	}
+	if v, ok := ctx.Value(TenantContextKey).(string); ok && v != "" {
+		return v, true
+	}
+	return "", false
+}
+
+// RecorderFactory creates the recorder of the tenant.
+type RecorderFactory func(tenant string) (Recorder, error)
+
+// NewMemRecorderFactory creates memory recorders sharing one id generator, so that ids are unique across tenants.
+func NewMemRecorderFactory(opts ...MemOpt) RecorderFactory {
+	idGenerator := NewIdGenerator()
+	return func(tenant string) (Recorder, error) {
+		return NewMemRecorder(append([]MemOpt{MemOpts.SetIdGenerator(idGenerator)}, opts...)...), nil
+	}
+}
+
+type TenantOpt func(f *tenantFilter)
+
+type tenantEntry struct {
+	tenant   string
+	recorder Recorder
+	lastUsed time.Time
+}
+
+// tenantFilter selects the recorder of the tenant in context, recorders are created by the factory
+// when the tenant is first seen and evicted when they are least recently used or idle.
+// Eviction drops the recorder and closes it if it is an io.Closer, so it is meant for recorders
+// backed by a persistent store.
+type tenantFilter struct {
+	locker        sync.Mutex
+	factory       RecorderFactory
+	defaultTenant string
+	capacity      int
+	idleTimeout   time.Duration
+
+	lru       *list.List
+	recorders map[string]*list.Element
+}
+
+func NewTenantFilter(factory RecorderFactory, opts ...TenantOpt) *tenantFilter {
+	ret := &tenantFilter{
+		factory:   factory,
+		lru:       list.New(),
+		recorders: map[string]*list.Element{},
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+func (f *tenantFilter) Filter(ctx context.Context) (Recorder, error) {
+	tenant, ok := TenantFrom(ctx)
+	if !ok {
+		if f.defaultTenant == "" {
+			return nil, NoTenantErr
+		}
+		tenant = f.defaultTenant
+	}
+
+	now := time.Now()
+	f.locker.Lock()
+	evicted := f.evictIdle(now)
+	e, ok := f.recorders[tenant]
+	if ok {
+		entry := e.Value.(*tenantEntry)
+		entry.lastUsed = now
+		f.lru.MoveToFront(e)
+		f.locker.Unlock()
+		closeAll(evicted)
+		return entry.recorder, nil
+	}
+	r, err := f.factory(tenant)
+	if err != nil {
+		f.locker.Unlock()
+		closeAll(evicted)
+		return nil, err
+	}
+	f.recorders[tenant] = f.lru.PushFront(&tenantEntry{
+		tenant:   tenant,
+		recorder: r,
+		lastUsed: now,
+	})
+	for f.capacity > 0 && f.lru.Len() > f.capacity {
+		evicted = append(evicted, f.remove(f.lru.Back()))
+	}
+	f.locker.Unlock()
+	closeAll(evicted)
+	return r, nil
+}
+
+// Evict drops the recorder of the tenant, it is created again when the tenant is seen.
+func (f *tenantFilter) Evict(tenant string) {
+	f.locker.Lock()
+	var evicted []Recorder
+	if e, ok := f.recorders[tenant]; ok {
+		evicted = append(evicted, f.remove(e))
+	}
+	f.locker.Unlock()
+	closeAll(evicted)
+}
+
+// Tenants returns tenants which have a recorder, the most recently used first.
+func (f *tenantFilter) Tenants() []string {
+	f.locker.Lock()
+	defer f.locker.Unlock()
+
+	ret := make([]string, 0, f.lru.Len())
+	for e := f.lru.Front(); e != nil; e = e.Next() {
+		ret = append(ret, e.Value.(*tenantEntry).tenant)
+	}
+	return ret
+}
+
+// evictIdle removes recorders idle longer than idleTimeout, must be called with lock held.
+func (f *tenantFilter) evictIdle(now time.Time) []Recorder {
+	if f.idleTimeout <= 0 {
+		return nil
+	}
+	var ret []Recorder
+	for e := f.lru.Back(); e != nil; e = f.lru.Back() {
+		if now.Sub(e.Value.(*tenantEntry).lastUsed) < f.idleTimeout {
+			break
+		}
+		ret = append(ret, f.remove(e))
+	}
+	return ret
+}
+
+// remove must be called with lock held.
+func (f *tenantFilter) remove(e *list.Element) Recorder {
+	entry := f.lru.Remove(e).(*tenantEntry)
+	delete(f.recorders, entry.tenant)
+	return entry.recorder
+}
+
+func closeAll(recorders []Recorder) {
+	for _, r := range recorders {
+		if c, ok := r.(io.Closer); ok {
+			_ = c.Close()
+		}
+	}
+}
+
+type tenantOpts struct{}
+
+var TenantOpts tenantOpts
+
+// SetDefaultTenant sets the tenant used when context carries none, empty means NoTenantErr is returned.
+func (o tenantOpts) SetDefaultTenant(tenant string) TenantOpt {
+	return func(f *tenantFilter) {
+		f.defaultTenant = tenant
+	}
+}
+
+// SetCapacity sets the max number of recorders kept, 0 means no limit.
+func (o tenantOpts) SetCapacity(n int) TenantOpt {
+	return func(f *tenantFilter) {
+		f.capacity = n
+	}
+}
+
+// SetIdleTimeout sets the time a recorder is kept without being used, 0 means no limit.
+func (o tenantOpts) SetIdleTimeout(d time.Duration) TenantOpt {
+	return func(f *tenantFilter) {
+		f.idleTimeout = d
+	}
+}
@@ -0,0 +1,341 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package servers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/xfali/neve-webhook/auth"
+	"github.com/xfali/neve-webhook/clients"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Permission scopes of routes of the management API.
+const (
+	ScopeRead  = "webhooks:read"
+	ScopeWrite = "webhooks:write"
+	// Reveal and rotate secrets
+	ScopeSecrets = "webhooks:secrets"
+	// Granted all scopes
+	ScopeAll = "*"
+
+	ApiKeyHeader = "X-Api-Key"
+
+	DefaultRequestTolerance = 5 * time.Minute
+)
+
+var (
+	// NoCredentialErr means the request has no credential which the authorizer accepts.
+	NoCredentialErr = errors.New("No credential ")
+	UnauthorizedErr = errors.New("Unauthorized ")
+	ForbiddenErr    = errors.New("Forbidden ")
+)
+
+type Authorizer interface {
+	// Authorize returns nil if the request is granted the scope.
+	// NoCredentialErr or UnauthorizedErr means the request is not authenticated, ForbiddenErr means the scope is not granted.
+	Authorize(req *http.Request, scope string) error
+}
+
+func hasScope(granted []string, scope string) bool {
+	for _, v := range granted {
+		if v == scope || v == ScopeAll {
+			return true
+		}
+	}
+	return false
+}
+
+func checkScope(granted []string, scope string) error {
+	if !hasScope(granted, scope) {
+		return ForbiddenErr
+	}
+	return nil
+}
+
+// chainAuthorizer authorizes by the first authorizer which accepts the credential of the request.
+type chainAuthorizer struct {
+	authorizers []Authorizer
+}
+
+func NewChainAuthorizer(authorizers ...Authorizer) *chainAuthorizer {
+	return &chainAuthorizer{
+		authorizers: authorizers,
+	}
+}
+
+func (c *chainAuthorizer) Authorize(req *http.Request, scope string) error {
+	for _, a := range c.authorizers {
+		if err := a.Authorize(req, scope); err != NoCredentialErr {
+			return err
+		}
+	}
+	return NoCredentialErr
+}
+
+// apiKeyAuthorizer authorizes requests with api key in X-Api-Key header.
+type apiKeyAuthorizer struct {
+	// sha256 of key to scopes
+	keys map[string][]string
+}
+
+// NewApiKeyAuthorizer creates authorizer with scopes of keys.
+func NewApiKeyAuthorizer(keys map[string][]string) *apiKeyAuthorizer {
+	ret := &apiKeyAuthorizer{
+		keys: make(map[string][]string, len(keys)),
+	}
+	for k, v := range keys {
+		ret.keys[hashKey(k)] = v
+	}
+	return ret
+}
+
+func (a *apiKeyAuthorizer) Authorize(req *http.Request, scope string) error {
+	key := req.Header.Get(ApiKeyHeader)
+	if key == "" {
+		return NoCredentialErr
+	}
+	// keys are compared by hash, so the time does not leak the key
+	scopes, ok := a.keys[hashKey(key)]
+	if !ok {
+		return UnauthorizedErr
+	}
+	return checkScope(scopes, scope)
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+type HmacOpt func(a *hmacAuthorizer)
+
+// hmacAuthorizer authorizes requests signed by auth.SignRequest with keys of keyring.
+// Signatures are remembered until their timestamps expire, so a signed request is accepted only once.
+type hmacAuthorizer struct {
+	keyring   auth.Keyring
+	scopes    map[string][]string
+	tolerance time.Duration
+	nonces    clients.NonceCache
+}
+
+// NewHmacAuthorizer creates authorizer with scopes of key ids, nil scopes grants all scopes to every key.
+func NewHmacAuthorizer(keyring auth.Keyring, scopes map[string][]string, opts ...HmacOpt) *hmacAuthorizer {
+	ret := &hmacAuthorizer{
+		keyring:   keyring,
+		scopes:    scopes,
+		tolerance: DefaultRequestTolerance,
+		nonces:    clients.NewLruNonceCache(clients.DefaultNonceCacheSize),
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+func (a *hmacAuthorizer) Authorize(req *http.Request, scope string) error {
+	ra, ok, err := auth.ParseRequestAuth(req.Header.Get("Authorization"))
+	if !ok {
+		return NoCredentialErr
+	}
+	if err != nil {
+		return UnauthorizedErr
+	}
+	if math.Abs(float64(time.Now().Unix()-ra.Timestamp)) > a.tolerance.Seconds() {
+		return UnauthorizedErr
+	}
+	key, ok := a.keyring.Get(ra.KeyID)
+	if !ok {
+		return UnauthorizedErr
+	}
+	body, err := readBody(req)
+	if err != nil {
+		return err
+	}
+	expect := auth.RequestSignature(key, req.Method, req.URL.RequestURI(), ra.Timestamp, body)
+	if !hmac.Equal([]byte(expect), []byte(ra.Signature)) {
+		return UnauthorizedErr
+	}
+	if a.scopes != nil {
+		if err := checkScope(a.scopes[ra.KeyID], scope); err != nil {
+			return err
+		}
+	}
+	// requests older than tolerance are rejected by the timestamp
+	if a.nonces != nil && !a.nonces.Add(ra.KeyID+":"+ra.Signature, time.Unix(ra.Timestamp, 0).Add(a.tolerance)) {
+		return UnauthorizedErr
+	}
+	return nil
+}
+
+type hmacOpts struct{}
+
+var HmacOpts hmacOpts
+
+// SetTolerance sets the max difference between the timestamp of request and now.
+func (o hmacOpts) SetTolerance(t time.Duration) HmacOpt {
+	return func(a *hmacAuthorizer) {
+		if t > 0 {
+			a.tolerance = t
+		}
+	}
+}
+
+// SetNonceCache sets the cache of signatures of accepted requests, e.g. a shared one of instances, nil to disable replay protection.
+func (o hmacOpts) SetNonceCache(nc clients.NonceCache) HmacOpt {
+	return func(a *hmacAuthorizer) {
+		a.nonces = nc
+	}
+}
+
+// readBody reads the body and puts it back for handlers.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+type JwtOpt func(a *jwtAuthorizer)
+
+// jwtAuthorizer authorizes requests with JWT bearer token verified by a local JWK set.
+// Scopes are read from scope and scp claims.
+// It is also a TenantResolver reading the tenant claim if it is set, see JwtOpts.SetTenantClaim.
+type jwtAuthorizer struct {
+	keys        auth.JWKSet
+	issuer      string
+	audience    string
+	leeway      time.Duration
+	tenantClaim string
+}
+
+func NewJwtAuthorizer(keys auth.JWKSet, opts ...JwtOpt) *jwtAuthorizer {
+	ret := &jwtAuthorizer{
+		keys:   keys,
+		leeway: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// NewJwtAuthorizerFromFile creates authorizer with JWK set of the file.
+func NewJwtAuthorizerFromFile(path string, opts ...JwtOpt) (*jwtAuthorizer, error) {
+	keys, err := auth.ReadJWKSFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewJwtAuthorizer(keys, opts...), nil
+}
+
+func (a *jwtAuthorizer) Authorize(req *http.Request, scope string) error {
+	claims, err := a.verify(req)
+	if err != nil {
+		return err
+	}
+	return checkScope(claims.AllScopes(), scope)
+}
+
+// ResolveTenant returns the tenant claim of the token, empty if the request carries no token.
+func (a *jwtAuthorizer) ResolveTenant(req *http.Request) (string, error) {
+	if a.tenantClaim == "" {
+		return "", nil
+	}
+	claims, err := a.verify(req)
+	if err != nil {
+		if errors.Is(err, NoCredentialErr) {
+			return "", nil
+		}
+		return "", err
+	}
+	tenant, _ := claims.Raw[a.tenantClaim].(string)
+	return tenant, nil
+}
+
+func (a *jwtAuthorizer) verify(req *http.Request) (*auth.JWTClaims, error) {
+	v := req.Header.Get("Authorization")
+	if len(v) < 7 || !strings.EqualFold(v[:7], "Bearer ") {
+		return nil, NoCredentialErr
+	}
+	claims, err := auth.VerifyJWT(strings.TrimSpace(v[7:]), a.keys, time.Now(), a.leeway)
+	if err != nil {
+		return nil, UnauthorizedErr
+	}
+	if a.issuer != "" && claims.Issuer != a.issuer {
+		return nil, UnauthorizedErr
+	}
+	if a.audience != "" && !hasAudience(claims.Audience, a.audience) {
+		return nil, UnauthorizedErr
+	}
+	return claims, nil
+}
+
+func hasAudience(aud []string, expect string) bool {
+	for _, v := range aud {
+		if v == expect {
+			return true
+		}
+	}
+	return false
+}
+
+type jwtOpts struct{}
+
+var JwtOpts jwtOpts
+
+// SetIssuer requires the iss claim of tokens.
+func (o jwtOpts) SetIssuer(iss string) JwtOpt {
+	return func(a *jwtAuthorizer) {
+		a.issuer = iss
+	}
+}
+
+// SetAudience requires the aud claim of tokens contains the audience.
+func (o jwtOpts) SetAudience(aud string) JwtOpt {
+	return func(a *jwtAuthorizer) {
+		a.audience = aud
+	}
+}
+
+// SetTenantClaim sets the claim of the tenant, the authorizer resolves tenants by it if it is set.
+func (o jwtOpts) SetTenantClaim(claim string) JwtOpt {
+	return func(a *jwtAuthorizer) {
+		a.tenantClaim = claim
+	}
+}
+
+// SetLeeway sets the allowed clock skew checking exp and nbf.
+func (o jwtOpts) SetLeeway(t time.Duration) JwtOpt {
+	return func(a *jwtAuthorizer) {
+		a.leeway = t
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package servers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/xfali/neve-webhook/auth"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthorizers(t *testing.T) {
+	keyring := auth.NewHmacKeyring()
+	if err := keyring.Generate("k1"); err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwt := NewJwtAuthorizer(auth.JWKSet{Keys: []auth.JWK{{
+		Kty: "OKP",
+		Crv: "Ed25519",
+		Kid: "j1",
+		X:   base64.RawURLEncoding.EncodeToString(pub),
+	}}}, JwtOpts.SetIssuer("test"), JwtOpts.SetTenantClaim("tenant"))
+	a := NewChainAuthorizer(
+		NewApiKeyAuthorizer(map[string][]string{"test-key": {ScopeRead}}),
+		NewHmacAuthorizer(keyring, map[string][]string{"k1": {ScopeAll}}),
+		jwt,
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/webhooks", nil)
+	if err := a.Authorize(req, ScopeRead); err != NoCredentialErr {
+		t.Fatalf("Expect no credential but get %v\n", err)
+	}
+	req.Header.Set(ApiKeyHeader, "test-key")
+	if err := a.Authorize(req, ScopeRead); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Authorize(req, ScopeWrite); err != ForbiddenErr {
+		t.Fatalf("Expect forbidden but get %v\n", err)
+	}
+
+	body := `{"url":"http://localhost/test"}`
+	req = httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body))
+	key, _ := keyring.Active()
+	auth.SignRequest(req, key, []byte(body), time.Now())
+	if err := a.Authorize(req, ScopeWrite); err != nil {
+		t.Fatal(err)
+	}
+	// replayed request
+	replay := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body))
+	replay.Header = req.Header.Clone()
+	if err := a.Authorize(replay, ScopeWrite); err != UnauthorizedErr {
+		t.Fatalf("Expect unauthorized replay but get %v\n", err)
+	}
+	req = httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(`{"url":"http://localhost/other"}`))
+	auth.SignRequest(req, key, []byte(body), time.Now())
+	if err := a.Authorize(req, ScopeWrite); err != UnauthorizedErr {
+		t.Fatalf("Expect unauthorized but get %v\n", err)
+	}
+
+	token := func(claims interface{}) string {
+		h, _ := json.Marshal(map[string]string{"alg": "EdDSA", "kid": "j1"})
+		c, _ := json.Marshal(claims)
+		content := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+		return content + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(priv, []byte(content)))
+	}
+	req = httptest.NewRequest(http.MethodPost, "/webhooks/1/secret/reveal", nil)
+	req.Header.Set("Authorization", "Bearer "+token(auth.JWTClaims{
+		Issuer:    "test",
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		Scope:     ScopeRead + " " + ScopeSecrets,
+	}))
+	if err := a.Authorize(req, ScopeSecrets); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Authorize(req, ScopeWrite); err != ForbiddenErr {
+		t.Fatalf("Expect forbidden but get %v\n", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token(auth.JWTClaims{
+		Issuer:    "test",
+		ExpiresAt: time.Now().Add(-time.Hour).Unix(),
+		Scope:     ScopeAll,
+	}))
+	if err := a.Authorize(req, ScopeRead); err != UnauthorizedErr {
+		t.Fatalf("Expect unauthorized but get %v\n", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token(map[string]interface{}{
+		"iss":    "test",
+		"exp":    time.Now().Add(time.Minute).Unix(),
+		"tenant": "t1",
+	}))
+	if tenant, err := jwt.ResolveTenant(req); err != nil || tenant != "t1" {
+		t.Fatalf("Expect tenant t1 but get %s %v\n", tenant, err)
+	}
+}
@@ -18,15 +18,20 @@
 package servers
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/xfali/neve-web/gineve/midware/loghttp"
 	"github.com/xfali/neve-web/result"
+	"github.com/xfali/neve-webhook/deadletter"
+	"github.com/xfali/neve-webhook/deliverylog"
+	"github.com/xfali/neve-webhook/events"
 	"github.com/xfali/neve-webhook/recorder"
 	"github.com/xfali/neve-webhook/service"
 	"github.com/xfali/xlog"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type ResponseFunc func(ctx *gin.Context, o interface{}) (abort bool)
@@ -38,6 +43,14 @@ type webHookHandler struct {
 
 	Service service.WebHookService `inject:""`
 
+	// Authorizer of routes, routes are not protected if it is nil
+	Authorizer Authorizer `inject:",omiterror"`
+
+	// Resolver of the tenant of requests, the tenant header is read if it is nil
+	TenantResolver TenantResolver `inject:",omiterror"`
+	// Header of the tenant, requests carry no tenant if both of it and TenantResolver are not set
+	TenantHeader string `fig:"neve.web.hooks.tenant.header"`
+
 	Group      string `fig:"neve.web.hooks.group"`
 	CreatePath string `fig:"neve.web.hooks.routes.create"`
 	UpdatePath string `fig:"neve.web.hooks.routes.update"`
@@ -45,6 +58,19 @@ type webHookHandler struct {
 	DetailPath string `fig:"neve.web.hooks.routes.detail"`
 	DeletePath string `fig:"neve.web.hooks.routes.delete"`
 
+	DeadLettersPath string `fig:"neve.web.hooks.routes.deadletters"`
+	DeadLetterPath  string `fig:"neve.web.hooks.routes.deadletter"`
+	ReplayPath      string `fig:"neve.web.hooks.routes.replay"`
+	DeliveriesPath  string `fig:"neve.web.hooks.routes.deliveries"`
+	DeliveryPath    string `fig:"neve.web.hooks.routes.delivery"`
+	RedeliverPath   string `fig:"neve.web.hooks.routes.redeliver"`
+	PingPath        string `fig:"neve.web.hooks.routes.ping"`
+	RotatePath      string `fig:"neve.web.hooks.routes.rotate"`
+	JwksPath        string `fig:"neve.web.hooks.routes.jwks"`
+	RevealPath      string `fig:"neve.web.hooks.routes.reveal"`
+	VerifyPath      string `fig:"neve.web.hooks.routes.verify"`
+	ChallengePath   string `fig:"neve.web.hooks.routes.challenge"`
+
 	respFunc ResponseFunc
 }
 
@@ -71,14 +97,110 @@ func (o *webHookHandler) HttpRoutes(engine gin.IRouter) {
 	if o.DeletePath == "" {
 		o.DeletePath = "/webhooks/:id"
 	}
+	if o.DeadLettersPath == "" {
+		o.DeadLettersPath = "/webhooks/:id/deadletters"
+	}
+	if o.DeadLetterPath == "" {
+		o.DeadLetterPath = "/webhooks/:id/deadletters/:letterId"
+	}
+	if o.ReplayPath == "" {
+		o.ReplayPath = "/webhooks/:id/deadletters/:letterId/replay"
+	}
+	if o.DeliveriesPath == "" {
+		o.DeliveriesPath = "/webhooks/:id/deliveries"
+	}
+	if o.DeliveryPath == "" {
+		o.DeliveryPath = "/webhooks/:id/deliveries/:deliveryId"
+	}
+	if o.RedeliverPath == "" {
+		o.RedeliverPath = "/webhooks/:id/deliveries/:deliveryId/redeliver"
+	}
+	if o.PingPath == "" {
+		o.PingPath = "/webhooks/:id/ping"
+	}
+	if o.RotatePath == "" {
+		o.RotatePath = "/webhooks/:id/secret/rotate"
+	}
+	if o.RevealPath == "" {
+		o.RevealPath = "/webhooks/:id/secret/reveal"
+	}
+	if o.JwksPath == "" {
+		o.JwksPath = "/webhooks/.well-known/jwks.json"
+	}
+	if o.VerifyPath == "" {
+		o.VerifyPath = "/webhooks/:id/verify"
+	}
+	if o.ChallengePath == "" {
+		o.ChallengePath = "/webhooks/:id/verify/challenge"
+	}
+	if o.Authorizer == nil {
+		o.logger.Warnln("Authorizer is not set, management API of webhooks is not protected")
+	}
+	if o.TenantResolver == nil && o.TenantHeader != "" {
+		o.TenantResolver = NewHeaderTenantResolver(o.TenantHeader)
+	}
 	if o.Group != "" {
 		engine = engine.Group(o.Group)
 	}
-	engine.POST(o.CreatePath, o.HLog.LogHttp(), o.create)
-	engine.PUT(o.UpdatePath, o.HLog.LogHttp(), o.update)
-	engine.GET(o.QueryPath, o.HLog.LogHttp(), o.get)
-	engine.GET(o.DetailPath, o.HLog.LogHttp(), o.detail)
-	engine.DELETE(o.DeletePath, o.HLog.LogHttp(), o.delete)
+	engine.POST(o.CreatePath, o.HLog.LogHttp(), o.authorize(ScopeWrite), o.tenant, o.create)
+	engine.PUT(o.UpdatePath, o.HLog.LogHttp(), o.authorize(ScopeWrite), o.tenant, o.update)
+	engine.GET(o.QueryPath, o.HLog.LogHttp(), o.authorize(ScopeRead), o.tenant, o.get)
+	engine.GET(o.DetailPath, o.HLog.LogHttp(), o.authorize(ScopeRead), o.tenant, o.detail)
+	engine.DELETE(o.DeletePath, o.HLog.LogHttp(), o.authorize(ScopeWrite), o.tenant, o.delete)
+	engine.GET(o.DeadLettersPath, o.HLog.LogHttp(), o.authorize(ScopeRead), o.tenant, o.deadLetters)
+	engine.DELETE(o.DeadLettersPath, o.HLog.LogHttp(), o.authorize(ScopeWrite), o.tenant, o.purgeDeadLetters)
+	engine.GET(o.DeadLetterPath, o.HLog.LogHttp(), o.authorize(ScopeRead), o.tenant, o.deadLetter)
+	engine.POST(o.ReplayPath, o.HLog.LogHttp(), o.authorize(ScopeWrite), o.tenant, o.replayDeadLetter)
+	engine.GET(o.DeliveriesPath, o.HLog.LogHttp(), o.authorize(ScopeRead), o.tenant, o.deliveries)
+	engine.GET(o.DeliveryPath, o.HLog.LogHttp(), o.authorize(ScopeRead), o.tenant, o.delivery)
+	engine.POST(o.RedeliverPath, o.HLog.LogHttp(), o.authorize(ScopeWrite), o.tenant, o.redeliver)
+	engine.POST(o.PingPath, o.HLog.LogHttp(), o.authorize(ScopeWrite), o.tenant, o.ping)
+	engine.POST(o.RotatePath, o.HLog.LogHttp(), o.authorize(ScopeSecrets), o.tenant, o.rotateSecret)
+	engine.GET(o.JwksPath, o.HLog.LogHttp(), o.jwks)
+	engine.POST(o.RevealPath, o.HLog.LogHttp(), o.authorize(ScopeSecrets), o.tenant, o.revealSecret)
+	// the challenge token authenticates the receiver
+	engine.POST(o.VerifyPath, o.HLog.LogHttp(), o.tenant, o.verify)
+	engine.POST(o.ChallengePath, o.HLog.LogHttp(), o.authorize(ScopeWrite), o.tenant, o.challenge)
+}
+
+// authorize aborts the request which is not granted the scope.
+func (o *webHookHandler) authorize(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if o.Authorizer == nil {
+			return
+		}
+		err := o.Authorizer.Authorize(ctx.Request, scope)
+		if err == nil {
+			return
+		}
+		switch {
+		case errors.Is(err, ForbiddenErr):
+			_ = ctx.AbortWithError(http.StatusForbidden, err)
+		case errors.Is(err, NoCredentialErr), errors.Is(err, UnauthorizedErr):
+			_ = ctx.AbortWithError(http.StatusUnauthorized, err)
+		default:
+			_ = ctx.AbortWithError(http.StatusInternalServerError, err)
+		}
+	}
+}
+
+// tenant puts the tenant of the request into the context, the recorder is filtered by it.
+func (o *webHookHandler) tenant(ctx *gin.Context) {
+	if o.TenantResolver == nil {
+		return
+	}
+	tenant, err := o.TenantResolver.ResolveTenant(ctx.Request)
+	if err != nil {
+		if errors.Is(err, UnauthorizedErr) {
+			_ = ctx.AbortWithError(http.StatusUnauthorized, err)
+		} else {
+			_ = ctx.AbortWithError(http.StatusBadRequest, err)
+		}
+		return
+	}
+	if tenant != "" {
+		ctx.Set(recorder.TenantContextKey, tenant)
+	}
 }
 
 func (o *webHookHandler) create(ctx *gin.Context) {
@@ -89,14 +211,14 @@ func (o *webHookHandler) create(ctx *gin.Context) {
 			return
 		}
 	}
-	id, err := o.Service.Create(ctx, d)
+	v, err := o.Service.Create(ctx, d)
 	if err != nil {
 		if o.respFunc(ctx, err) {
 			return
 		}
 	}
 
-	_ = o.respFunc(ctx, id)
+	_ = o.respFunc(ctx, v)
 }
 
 func (o *webHookHandler) update(ctx *gin.Context) {
@@ -184,6 +306,260 @@ func (o *webHookHandler) delete(ctx *gin.Context) {
 	_ = o.respFunc(ctx, nil)
 }
 
+func (o *webHookHandler) deadLetters(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if id == "" {
+		if o.respFunc(ctx, fmt.Errorf("Path param id invalid ")) {
+			return
+		}
+	}
+	eventType := ctx.Query("event_type")
+	currentPageStr := ctx.Query("current_page")
+	pageSizeStr := ctx.Query("page_size")
+	var currentPage int64 = 0
+	var pageSize int64 = 32
+	if v, err := strconv.ParseInt(currentPageStr, 10, 64); err == nil {
+		currentPage = v
+	}
+	if v, err := strconv.ParseInt(pageSizeStr, 10, 64); err == nil {
+		pageSize = v
+	}
+	v, err := o.Service.ListDeadLetters(ctx, deadletter.QueryCondition{
+		WebhookID: id,
+		EventType: eventType,
+		Offset:    currentPage,
+		PageSize:  pageSize,
+	})
+	if err != nil {
+		if o.respFunc(ctx, err) {
+			return
+		}
+	}
+
+	_ = o.respFunc(ctx, v)
+}
+
+func (o *webHookHandler) deadLetter(ctx *gin.Context) {
+	id := ctx.Param("id")
+	letterId := ctx.Param("letterId")
+	if id == "" || letterId == "" {
+		if o.respFunc(ctx, fmt.Errorf("Path param id invalid ")) {
+			return
+		}
+	}
+	v, err := o.Service.DeadLetter(ctx, id, letterId)
+	if err != nil {
+		if o.respFunc(ctx, err) {
+			return
+		}
+	}
+	_ = o.respFunc(ctx, v)
+}
+
+func (o *webHookHandler) replayDeadLetter(ctx *gin.Context) {
+	id := ctx.Param("id")
+	letterId := ctx.Param("letterId")
+	if id == "" || letterId == "" {
+		if o.respFunc(ctx, fmt.Errorf("Path param id invalid ")) {
+			return
+		}
+	}
+	err := o.Service.ReplayDeadLetter(ctx, id, letterId)
+	if err != nil {
+		if o.respFunc(ctx, err) {
+			return
+		}
+	}
+
+	_ = o.respFunc(ctx, nil)
+}
+
+func (o *webHookHandler) purgeDeadLetters(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if id == "" {
+		if o.respFunc(ctx, fmt.Errorf("Path param id invalid ")) {
+			return
+		}
+	}
+	err := o.Service.PurgeDeadLetters(ctx, id)
+	if err != nil {
+		if o.respFunc(ctx, err) {
+			return
+		}
+	}
+
+	_ = o.respFunc(ctx, nil)
+}
+
+func (o *webHookHandler) deliveries(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if id == "" {
+		if o.respFunc(ctx, fmt.Errorf("Path param id invalid ")) {
+			return
+		}
+	}
+	eventType := ctx.Query("event_type")
+	currentPageStr := ctx.Query("current_page")
+	pageSizeStr := ctx.Query("page_size")
+	var currentPage int64 = 0
+	var pageSize int64 = 32
+	if v, err := strconv.ParseInt(currentPageStr, 10, 64); err == nil {
+		currentPage = v
+	}
+	if v, err := strconv.ParseInt(pageSizeStr, 10, 64); err == nil {
+		pageSize = v
+	}
+	v, err := o.Service.Deliveries(ctx, deliverylog.QueryCondition{
+		WebhookID: id,
+		EventType: eventType,
+		Offset:    currentPage,
+		PageSize:  pageSize,
+	})
+	if err != nil {
+		if o.respFunc(ctx, err) {
+			return
+		}
+	}
+
+	_ = o.respFunc(ctx, v)
+}
+
+func (o *webHookHandler) delivery(ctx *gin.Context) {
+	id := ctx.Param("id")
+	deliveryId := ctx.Param("deliveryId")
+	if id == "" || deliveryId == "" {
+		if o.respFunc(ctx, fmt.Errorf("Path param id invalid ")) {
+			return
+		}
+	}
+	v, err := o.Service.Delivery(ctx, id, deliveryId)
+	if err != nil {
+		if o.respFunc(ctx, err) {
+			return
+		}
+	}
+	_ = o.respFunc(ctx, v)
+}
+
+func (o *webHookHandler) redeliver(ctx *gin.Context) {
+	id := ctx.Param("id")
+	deliveryId := ctx.Param("deliveryId")
+	if id == "" || deliveryId == "" {
+		if o.respFunc(ctx, fmt.Errorf("Path param id invalid ")) {
+			return
+		}
+	}
+	v, err := o.Service.Redeliver(ctx, id, deliveryId)
+	if err != nil {
+		if o.respFunc(ctx, err) {
+			return
+		}
+	}
+	_ = o.respFunc(ctx, v)
+}
+
+func (o *webHookHandler) ping(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if id == "" {
+		if o.respFunc(ctx, fmt.Errorf("Path param id invalid ")) {
+			return
+		}
+	}
+	v, err := o.Service.Ping(ctx, id)
+	if err != nil {
+		if o.respFunc(ctx, err) {
+			return
+		}
+	}
+	_ = o.respFunc(ctx, v)
+}
+
+func (o *webHookHandler) verify(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if id == "" {
+		if o.respFunc(ctx, fmt.Errorf("Path param id invalid ")) {
+			return
+		}
+	}
+	d := events.VerificationReply{}
+	err := ctx.Bind(&d)
+	if err != nil {
+		if o.respFunc(ctx, err) {
+			return
+		}
+	}
+	err = o.Service.Verify(ctx, id, d.Response)
+	if err != nil {
+		if o.respFunc(ctx, err) {
+			return
+		}
+	}
+	_ = o.respFunc(ctx, nil)
+}
+
+func (o *webHookHandler) challenge(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if id == "" {
+		if o.respFunc(ctx, fmt.Errorf("Path param id invalid ")) {
+			return
+		}
+	}
+	v, err := o.Service.Challenge(ctx, id)
+	if err != nil {
+		if o.respFunc(ctx, err) {
+			return
+		}
+	}
+	_ = o.respFunc(ctx, v)
+}
+
+// rotateSecret accepts optional query param grace in seconds.
+func (o *webHookHandler) rotateSecret(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if id == "" {
+		if o.respFunc(ctx, fmt.Errorf("Path param id invalid ")) {
+			return
+		}
+	}
+	var grace time.Duration
+	if v, err := strconv.ParseInt(ctx.Query("grace"), 10, 64); err == nil {
+		grace = time.Duration(v) * time.Second
+	}
+	v, err := o.Service.RotateSecret(ctx, id, grace)
+	if err != nil {
+		if o.respFunc(ctx, err) {
+			return
+		}
+	}
+	_ = o.respFunc(ctx, v)
+}
+
+func (o *webHookHandler) revealSecret(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if id == "" {
+		if o.respFunc(ctx, fmt.Errorf("Path param id invalid ")) {
+			return
+		}
+	}
+	v, err := o.Service.RevealSecret(ctx, id)
+	if err != nil {
+		if o.respFunc(ctx, err) {
+			return
+		}
+	}
+	_ = o.respFunc(ctx, v)
+}
+
+// jwks responds the JWK set as is for standard consumers.
+func (o *webHookHandler) jwks(ctx *gin.Context) {
+	v, err := o.Service.JWKS(ctx)
+	if err != nil {
+		_ = ctx.AbortWithError(http.StatusNotFound, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, v)
+}
+
 func defaultResponse(ctx *gin.Context, o interface{}) bool {
 	if o == nil {
 		ctx.Status(http.StatusOK)
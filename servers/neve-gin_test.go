@@ -0,0 +1,65 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package servers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/xfali/neve-core/bean"
+	"github.com/xfali/neve-core/injector"
+	"github.com/xfali/neve-web/gineve/midware/loghttp"
+	"github.com/xfali/neve-webhook/manager"
+	"github.com/xfali/neve-webhook/recorder"
+	"github.com/xfali/xlog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerWithoutAuthorizer(t *testing.T) {
+	c := bean.NewContainer()
+	r := recorder.NewMemRecorder()
+	for _, o := range []interface{}{r, manager.NewBlockManager(r), loghttp.NewHttpLogger(xlog.GetLogger())} {
+		if err := c.Register(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewWebHookService()
+	h := NewWebHookHandler()
+	// optional beans are not registered, injection must not panic
+	i := injector.New()
+	if err := i.Inject(c, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Register(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.Inject(c, h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Authorizer != nil || h.TenantResolver != nil {
+		t.Fatal("Expect no authorizer and tenant resolver")
+	}
+
+	engine := gin.New()
+	h.HttpRoutes(engine)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/webhooks", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expect 200 but get %d\n", w.Code)
+	}
+}
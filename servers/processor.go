@@ -19,7 +19,9 @@ package servers
 
 import (
 	"github.com/xfali/fig"
+	"github.com/xfali/neve-core/appcontext"
 	"github.com/xfali/neve-core/bean"
+	"github.com/xfali/neve-webhook/auth"
 	"github.com/xfali/neve-webhook/manager"
 	"github.com/xfali/neve-webhook/recorder"
 )
@@ -30,20 +32,32 @@ type RecorderCreator func() recorder.Recorder
 
 type ManagerCreator func(r recorder.Recorder) manager.Manager
 
+// TenantFactoryCreator creates the recorder factory of tenants, sealer is nil if the sealer keyring is not configured.
+type TenantFactoryCreator func(sealer auth.SecretSealer) recorder.RecorderFactory
+
+// MemTenantFactory creates memory recorders of tenants, see ProcessorOpts.SetTenantFactory.
+func MemTenantFactory(sealer auth.SecretSealer) recorder.RecorderFactory {
+	return recorder.NewMemRecorderFactory(recorder.MemOpts.SetSecretSealer(sealer))
+}
+
 type neveGinProcessor struct {
 	recorderCreator RecorderCreator
 	managerCreator  ManagerCreator
+	appCtx          appcontext.ApplicationContext
+	sealerKeyring   *auth.HmacKeyring
+	authorizer      Authorizer
+	tenantResolver  TenantResolver
 }
 
 func NewWebhooksServerProcessor(opts ...ProcessorOpt) *neveGinProcessor {
 	ret := &neveGinProcessor{
-		recorderCreator: func() recorder.Recorder {
-			return recorder.NewMemRecorder()
-		},
 		managerCreator: func(r recorder.Recorder) manager.Manager {
 			return manager.NewManager(r)
 		},
 	}
+	ret.recorderCreator = func() recorder.Recorder {
+		return recorder.NewMemRecorder(recorder.MemOpts.SetSecretSealer(ret.sealer()))
+	}
 	for _, opt := range opts {
 		opt(ret)
 	}
@@ -51,14 +65,56 @@ func NewWebhooksServerProcessor(opts ...ProcessorOpt) *neveGinProcessor {
 }
 
 func (p *neveGinProcessor) Init(conf fig.Properties, container bean.Container) error {
+	keyringConf := auth.KeyringConfig{}
+	// keyring is optional, it authorizes requests signed by its keys unless an authorizer is set
+	if err := conf.GetValue(auth.KeyringConfigKey, &keyringConf); err == nil && p.authorizer == nil {
+		keyring, err := auth.NewHmacKeyringFromConfig(keyringConf)
+		if err != nil {
+			return err
+		}
+		p.authorizer = NewHmacAuthorizer(keyring, nil)
+	}
+	// the sealer keyring is not registered, it is only used to seal secrets
+	sealerConf := auth.KeyringConfig{}
+	if err := conf.GetValue(auth.SealerKeyringConfigKey, &sealerConf); err == nil {
+		keyring, err := auth.NewHmacKeyringFromConfig(sealerConf)
+		if err != nil {
+			return err
+		}
+		p.sealerKeyring = keyring
+	}
 	recorder := p.recorderCreator()
 	if err := container.Register(recorder); err != nil {
 		return err
 	}
-	manager := p.managerCreator(recorder)
-	if err := container.Register(manager); err != nil {
+	mgr := p.managerCreator(recorder)
+	if err := container.Register(mgr); err != nil {
 		return err
 	}
+	if a, ok := mgr.(manager.PublisherAware); ok {
+		a.SetPublisher(p)
+	}
+	if h, ok := mgr.(manager.DeadLetterHolder); ok && h.DeadLetterStore() != nil {
+		if err := container.Register(h.DeadLetterStore()); err != nil {
+			return err
+		}
+	}
+	if h, ok := mgr.(manager.DeliveryLogHolder); ok && h.DeliveryLog() != nil {
+		if err := container.Register(h.DeliveryLog()); err != nil {
+			return err
+		}
+	}
+	if p.authorizer != nil {
+		if err := container.Register(p.authorizer); err != nil {
+			return err
+		}
+	}
+	// the authorizer may be the resolver too, e.g. JWT authorizer
+	if p.tenantResolver != nil && interface{}(p.tenantResolver) != interface{}(p.authorizer) {
+		if err := container.Register(p.tenantResolver); err != nil {
+			return err
+		}
+	}
 	if err := container.Register(NewWebHookService()); err != nil {
 		return err
 	}
@@ -68,6 +124,14 @@ func (p *neveGinProcessor) Init(conf fig.Properties, container bean.Container) e
 	return nil
 }
 
+// sealer returns nil if the sealer keyring is not configured.
+func (p *neveGinProcessor) sealer() auth.SecretSealer {
+	if p.sealerKeyring == nil {
+		return nil
+	}
+	return auth.NewAesGcmSealer(p.sealerKeyring)
+}
+
 func (p *neveGinProcessor) Classify(o interface{}) (bool, error) {
 	return false, nil
 }
@@ -96,3 +160,28 @@ func (o processorOpts) ManagerCreator(creator ManagerCreator) ProcessorOpt {
 		processor.managerCreator = creator
 	}
 }
+
+// SetAuthorizer registers the authorizer of the management API, e.g. NewChainAuthorizer(NewApiKeyAuthorizer(keys), NewHmacAuthorizer(keyring, nil)).
+func (o processorOpts) SetAuthorizer(a Authorizer) ProcessorOpt {
+	return func(processor *neveGinProcessor) {
+		processor.authorizer = a
+	}
+}
+
+// SetTenantFactory isolates webhooks per tenant, the recorder of each tenant is created by the factory
+// which seals secrets by the given sealer, e.g. MemTenantFactory. Tenants of requests are resolved by the TenantResolver.
+func (o processorOpts) SetTenantFactory(creator TenantFactoryCreator, opts ...recorder.TenantOpt) ProcessorOpt {
+	return func(processor *neveGinProcessor) {
+		processor.recorderCreator = func() recorder.Recorder {
+			factory := creator(processor.sealer())
+			return recorder.NewSimpleRecorder(recorder.Opts.SetFilter(recorder.NewTenantFilter(factory, opts...)))
+		}
+	}
+}
+
+// SetTenantResolver registers the resolver of the tenant of requests, e.g. NewHeaderTenantResolver(DefaultTenantHeader).
+func (o processorOpts) SetTenantResolver(r TenantResolver) ProcessorOpt {
+	return func(processor *neveGinProcessor) {
+		processor.tenantResolver = r
+	}
+}
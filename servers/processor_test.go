@@ -0,0 +1,128 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package servers
+
+import (
+	"context"
+	"github.com/xfali/fig"
+	"github.com/xfali/neve-core/appcontext"
+	"github.com/xfali/neve-core/bean"
+	"github.com/xfali/neve-webhook/auth"
+	"github.com/xfali/neve-webhook/events"
+	"github.com/xfali/neve-webhook/recorder"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessorKeyringAuthorizer(t *testing.T) {
+	conf := `
+neve:
+  web:
+    hooks:
+      keyring:
+        keys:
+          - id: k1
+            secret: dGVzdC1zZWNyZXQ=
+`
+	p := NewWebhooksServerProcessor()
+	if err := p.Init(fig.New(fig.SetValue(strings.NewReader(conf))), bean.NewContainer()); err != nil {
+		t.Fatal(err)
+	}
+	if p.authorizer == nil {
+		t.Fatal("Expect authorizer of the keyring")
+	}
+	req := httptest.NewRequest(http.MethodGet, "/webhooks", nil)
+	if err := p.authorizer.Authorize(req, ScopeRead); err != NoCredentialErr {
+		t.Fatalf("Expect no credential but get %v\n", err)
+	}
+	auth.SignRequest(req, auth.Key{ID: "k1", Secret: []byte("test-secret")}, nil, time.Now())
+	if err := p.authorizer.Authorize(req, ScopeRead); err != nil {
+		t.Fatal(err)
+	}
+
+	// the authorizer set by option is kept
+	a := NewApiKeyAuthorizer(nil)
+	p = NewWebhooksServerProcessor(ProcessorOpts.SetAuthorizer(a))
+	if err := p.Init(fig.New(fig.SetValue(strings.NewReader(conf))), bean.NewContainer()); err != nil {
+		t.Fatal(err)
+	}
+	if p.authorizer != a {
+		t.Fatal("Expect authorizer of option")
+	}
+}
+
+func TestProcessorTenantSealer(t *testing.T) {
+	conf := `
+neve:
+  web:
+    hooks:
+      sealer:
+        keyring:
+          keys:
+            - id: s1
+              secret: dGVzdC1zZWNyZXQ=
+`
+	var sealer auth.SecretSealer
+	p := NewWebhooksServerProcessor(ProcessorOpts.SetTenantFactory(func(s auth.SecretSealer) recorder.RecorderFactory {
+		sealer = s
+		return MemTenantFactory(s)
+	}))
+	if err := p.Init(fig.New(fig.SetValue(strings.NewReader(conf))), bean.NewContainer()); err != nil {
+		t.Fatal(err)
+	}
+	if sealer == nil {
+		t.Fatal("Expect secrets of tenants sealed")
+	}
+	sealed, err := sealer.Seal("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auth.IsSealed(sealed) {
+		t.Fatalf("Expect sealed but get %s\n", sealed)
+	}
+}
+
+type publishedContext struct {
+	appcontext.ApplicationContext
+	events []appcontext.ApplicationEvent
+}
+
+func (c *publishedContext) PublishEvent(e appcontext.ApplicationEvent) error {
+	c.events = append(c.events, e)
+	return nil
+}
+
+func TestProcessorPublishTenant(t *testing.T) {
+	p := NewWebhooksServerProcessor()
+	ctx := &publishedContext{}
+	p.SetApplicationContext(ctx)
+	event := events.WithTenant(&events.Event{Type: "webhook.disabled", PayLoad: "1"}, "a")
+	if err := p.Publish(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if len(ctx.events) != 1 {
+		t.Fatalf("Expect 1 event but get %d\n", len(ctx.events))
+	}
+	e := ctx.events[0].(*ManagerEvent)
+	if e.Type != "webhook.disabled" || e.Tenant != "a" {
+		t.Fatalf("Expect event of tenant a but get %v\n", e)
+	}
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package servers
+
+import (
+	"context"
+	"errors"
+	"github.com/xfali/neve-core/appcontext"
+	"github.com/xfali/neve-webhook/events"
+)
+
+var ContextNotReadyErr = errors.New("Application context is not ready ")
+
+// ManagerEvent is an internal event of the manager published to the application context, e.g. a webhook is gone.
+// Listen to it by a consumer func(*ManagerEvent).
+type ManagerEvent struct {
+	appcontext.BaseApplicationEvent
+
+	Type    string
+	PayLoad interface{}
+	// Tenant of the webhook, empty if webhooks are not isolated per tenant
+	Tenant string
+}
+
+func (p *neveGinProcessor) SetApplicationContext(ctx appcontext.ApplicationContext) {
+	p.appCtx = ctx
+}
+
+func (p *neveGinProcessor) Publish(ctx context.Context, event events.IEvent) error {
+	if p.appCtx == nil {
+		return ContextNotReadyErr
+	}
+	e := &ManagerEvent{
+		Type:    event.GetType(),
+		PayLoad: event.GetPayLoad(),
+		Tenant:  events.TenantOf(event),
+	}
+	e.ResetOccurredTime()
+	return p.appCtx.PublishEvent(e)
+}
@@ -19,15 +19,53 @@ package servers
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/xfali/neve-webhook/auth"
+	"github.com/xfali/neve-webhook/deadletter"
+	"github.com/xfali/neve-webhook/deliverylog"
+	"github.com/xfali/neve-webhook/events"
+	"github.com/xfali/neve-webhook/manager"
+	"github.com/xfali/neve-webhook/notifier"
 	"github.com/xfali/neve-webhook/recorder"
 	"github.com/xfali/neve-webhook/service"
 	"github.com/xfali/xlog"
+	"time"
+)
+
+const (
+	DefaultSecretGrace = 24 * time.Hour
+)
+
+var (
+	DeadLetterDisabledErr  = errors.New("Dead letter store is not configured ")
+	KeyringDisabledErr     = errors.New("Messages are not signed by asymmetric keys ")
+	DeliveryLogDisabledErr = errors.New("Delivery log is not configured ")
+	UnknownProfileErr      = errors.New("Unknown signature profile ")
+	NotPendingErr          = errors.New("Webhook is not pending verification ")
+	NotVerifiedErr         = errors.New("Webhook is pending verification ")
+	InvalidTokenErr        = errors.New("Invalid verification token ")
+	ReservedSecretErr      = errors.New("Secret cannot start with " + auth.SealedSecretPrefix + " ")
+	MaskedSecretErr        = errors.New("Masked secret cannot replace a different authentication ")
 )
 
 type webHookServiceImpl struct {
 	logger   xlog.Logger
 	Recorder recorder.Recorder `inject:""`
+	Manager  manager.Manager   `inject:""`
+	// Nil if the manager has no dead letter store
+	DeadLetters deadletter.Store `inject:",omiterror"`
+	// Nil if the manager has no delivery log
+	DeliveryLog deliverylog.Store `inject:",omiterror"`
+
+	// Default grace period in seconds of rotated secrets
+	SecretGrace int `fig:"neve.web.hooks.secret.grace"`
+	// Webhooks are pending verification until their endpoints answer the challenge
+	Verification bool `fig:"neve.web.hooks.verification.enabled"`
 }
 
 func NewWebHookService() *webHookServiceImpl {
@@ -36,33 +74,443 @@ func NewWebHookService() *webHookServiceImpl {
 	}
 }
 
-func (s *webHookServiceImpl) Create(ctx context.Context, rec recorder.Input) (string, error) {
-	return s.Recorder.Create(ctx, rec)
+func (s *webHookServiceImpl) Create(ctx context.Context, rec recorder.Input) (service.WebhookCreated, error) {
+	if err := s.check(rec); err != nil {
+		return service.WebhookCreated{}, err
+	}
+	if rec.Secret == "" {
+		secret, err := auth.NewStandardSecret()
+		if err != nil {
+			return service.WebhookCreated{}, err
+		}
+		rec.Secret = secret
+	}
+	rec.State = ""
+	if s.Verification {
+		if err := pendVerification(&rec); err != nil {
+			return service.WebhookCreated{}, err
+		}
+	}
+	id, err := s.Recorder.Create(ctx, rec)
+	if err != nil {
+		return service.WebhookCreated{}, err
+	}
+	ret := service.WebhookCreated{
+		ID:     id,
+		Secret: rec.Secret,
+		State:  recorder.HookStateNormal,
+	}
+	if s.Verification {
+		ret.State = recorder.HookStatePendingVerification
+		if _, ok := s.challenge(ctx, id, rec.VerificationToken); ok {
+			ret.State = recorder.HookStateNormal
+		}
+	}
+	return ret, nil
 }
 
 func (s *webHookServiceImpl) Update(ctx context.Context, id string, rec recorder.Input) error {
-	return s.Recorder.Update(ctx, id, rec)
+	if err := s.check(rec); err != nil {
+		return err
+	}
+	d, err := s.get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := unmask(&rec, d); err != nil {
+		return err
+	}
+	if !s.Verification {
+		return s.Recorder.Update(ctx, id, rec)
+	}
+	pending := d.State == recorder.HookStatePendingVerification
+	if pending && rec.State != "" && rec.State != recorder.HookStatePendingVerification {
+		return NotVerifiedErr
+	}
+	// the new endpoint must be verified as well
+	if rec.Url != "" && rec.Url != d.Url {
+		if err := pendVerification(&rec); err != nil {
+			return err
+		}
+	} else if pending {
+		rec.State = ""
+	}
+	if err := s.Recorder.Update(ctx, id, rec); err != nil {
+		return err
+	}
+	if rec.State == recorder.HookStatePendingVerification {
+		s.challenge(ctx, id, rec.VerificationToken)
+	}
+	return nil
+}
+
+// unmask keeps stored secrets where the input carries masked ones returned by Get and Detail,
+// so that read-modify-write does not overwrite them.
+func unmask(rec *recorder.Input, d recorder.Data) error {
+	if auth.IsMasked(rec.Secret) {
+		// empty secret is not updated
+		rec.Secret = ""
+	}
+	if rec.OutboundAuth == nil {
+		return nil
+	}
+	a := *rec.OutboundAuth
+	stored := recorder.OutboundAuth{}
+	if d.OutboundAuth != nil {
+		stored = *d.OutboundAuth
+	}
+	for _, v := range []struct {
+		input  *string
+		stored string
+	}{
+		{&a.Password, stored.Password},
+		{&a.Token, stored.Token},
+		{&a.ClientSecret, stored.ClientSecret},
+	} {
+		if !auth.IsMasked(*v.input) {
+			continue
+		}
+		if a.Type != stored.Type || v.stored == "" {
+			return MaskedSecretErr
+		}
+		*v.input = v.stored
+	}
+	rec.OutboundAuth = &a
+	return nil
+}
+
+func (s *webHookServiceImpl) get(ctx context.Context, id string) (recorder.Data, error) {
+	v, _, err := s.Recorder.Query(ctx, recorder.QueryCondition{Id: id})
+	if err != nil {
+		return recorder.Data{}, err
+	}
+	if len(v) == 0 {
+		return recorder.Data{}, fmt.Errorf("ID %s not found ", id)
+	}
+	return v[0], nil
+}
+
+// own checks the webhook belongs to the tenant of ctx, dead letters and deliveries are stored regardless of tenants.
+func (s *webHookServiceImpl) own(ctx context.Context, id string) error {
+	if _, ok := recorder.TenantFrom(ctx); !ok {
+		return nil
+	}
+	if id == "" {
+		return fmt.Errorf("Webhook ID is required ")
+	}
+	_, err := s.get(ctx, id)
+	return err
+}
+
+func pendVerification(rec *recorder.Input) error {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	rec.State = recorder.HookStatePendingVerification
+	rec.VerificationToken = hex.EncodeToString(token)
+	return nil
+}
+
+// challenge sends the token to the webhook, return true if it is verified by the reply.
+func (s *webHookServiceImpl) challenge(ctx context.Context, id, token string) (*notifier.Response, bool) {
+	resp, err := s.Manager.Send(ctx, id, &events.Event{
+		Type: events.VerificationEventType,
+		PayLoad: events.VerificationPayload{
+			WebhookID: id,
+			Token:     token,
+			Time:      time.Now(),
+		},
+	}, nil)
+	if err != nil {
+		s.logger.Warnf("Challenge of webhook %s failed: %v\n", id, err)
+		return resp, false
+	}
+	reply := events.VerificationReply{}
+	if err := json.Unmarshal(resp.Body, &reply); err != nil || reply.Response == "" {
+		s.logger.Warnf("Verify webhook %s failed: invalid reply\n", id)
+		return resp, false
+	}
+	if err := s.Verify(ctx, id, reply.Response); err != nil {
+		s.logger.Warnf("Verify webhook %s failed: %v\n", id, err)
+		return resp, false
+	}
+	return resp, true
+}
+
+func (s *webHookServiceImpl) Challenge(ctx context.Context, id string) (service.SendResult, error) {
+	d, err := s.get(ctx, id)
+	if err != nil {
+		return service.SendResult{}, err
+	}
+	if d.State != recorder.HookStatePendingVerification {
+		return service.SendResult{}, NotPendingErr
+	}
+	resp, _ := s.challenge(ctx, id, d.VerificationToken)
+	if resp == nil {
+		return service.SendResult{}, fmt.Errorf("Send challenge to webhook %s failed ", id)
+	}
+	return service.NewSendResult(resp), nil
+}
+
+func (s *webHookServiceImpl) Verify(ctx context.Context, id string, token string) error {
+	d, err := s.get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if d.State != recorder.HookStatePendingVerification {
+		return NotPendingErr
+	}
+	if d.VerificationToken == "" || subtle.ConstantTimeCompare([]byte(d.VerificationToken), []byte(token)) != 1 {
+		return InvalidTokenErr
+	}
+	return s.Recorder.Update(ctx, id, recorder.Input{
+		Url:               d.Url,
+		ContentType:       d.ContentType,
+		Secret:            d.Secret,
+		TriggerEventTypes: d.TriggerEventTypes,
+		State:             recorder.HookStateNormal,
+		RateLimit:         d.RateLimit,
+		RateBurst:         d.RateBurst,
+		SignatureProfile:  d.SignatureProfile,
+		OutboundAuth:      d.OutboundAuth,
+	})
+}
+
+func (s *webHookServiceImpl) check(rec recorder.Input) error {
+	if h, ok := s.Manager.(manager.SignatureProfileHolder); ok {
+		if _, ok := h.SignatureProfile(rec.SignatureProfile); !ok {
+			return fmt.Errorf("%w%s ", UnknownProfileErr, rec.SignatureProfile)
+		}
+	}
+	// sealed secrets stored in plaintext cannot be opened after sealing is enabled
+	if auth.IsSealed(rec.Secret) {
+		return ReservedSecretErr
+	}
+	if rec.OutboundAuth != nil {
+		a := rec.OutboundAuth
+		if auth.IsSealed(a.Password) || auth.IsSealed(a.Token) || auth.IsSealed(a.ClientSecret) {
+			return ReservedSecretErr
+		}
+		return a.Validate()
+	}
+	return nil
 }
 
 func (s *webHookServiceImpl) Get(ctx context.Context, cond recorder.QueryCondition) (service.ListData, error) {
 	v, total, err := s.Recorder.Query(ctx, cond)
+	for i := range v {
+		maskSecrets(&v[i])
+	}
 	return service.ListData{
 		Webhooks: v,
 		Total:    total,
 	}, err
 }
 
-func (s *webHookServiceImpl) Detail(ctx context.Context, id string) (recorder.Data, error) {
+func (s *webHookServiceImpl) Detail(ctx context.Context, id string) (service.WebhookDetail, error) {
 	v, _, err := s.Recorder.Query(ctx, recorder.QueryCondition{Id: id})
 	if err != nil {
-		return recorder.Data{}, err
+		return service.WebhookDetail{}, err
 	}
 	if len(v) == 0 {
-		return recorder.Data{}, fmt.Errorf("ID %s not found ", id)
+		return service.WebhookDetail{}, fmt.Errorf("ID %s not found ", id)
+	}
+	ret := service.WebhookDetail{
+		Data: v[0],
+	}
+	if h, ok := s.Manager.(manager.RateLimiterHolder); ok {
+		if state := h.RateLimiterState(ctx, v[0]); state != nil {
+			ret.RateLimiter = &service.RateLimiterState{
+				Rate:   state.Rate,
+				Burst:  state.Burst,
+				Tokens: state.Tokens,
+				Queued: state.Queued,
+			}
+		}
+	}
+	maskSecrets(&ret.Data)
+	return ret, nil
+}
+
+func maskSecrets(d *recorder.Data) {
+	d.Secret = auth.MaskSecret(d.Secret)
+	d.PreviousSecret = auth.MaskSecret(d.PreviousSecret)
+	if d.OutboundAuth != nil {
+		// the recorder may return the stored one
+		a := *d.OutboundAuth
+		a.Password = auth.MaskSecret(a.Password)
+		a.Token = auth.MaskSecret(a.Token)
+		a.ClientSecret = auth.MaskSecret(a.ClientSecret)
+		d.OutboundAuth = &a
 	}
-	return v[0], nil
 }
 
 func (s *webHookServiceImpl) Delete(ctx context.Context, id string) error {
-	return s.Recorder.Delete(ctx, id)
+	if err := s.Recorder.Delete(ctx, id); err != nil {
+		return err
+	}
+	if h, ok := s.Manager.(manager.WebhookStateHolder); ok {
+		h.Forget(ctx, id)
+	}
+	return nil
+}
+
+func (s *webHookServiceImpl) ListDeadLetters(ctx context.Context, cond deadletter.QueryCondition) (service.DeadLetterList, error) {
+	if s.DeadLetters == nil {
+		return service.DeadLetterList{}, DeadLetterDisabledErr
+	}
+	if err := s.own(ctx, cond.WebhookID); err != nil {
+		return service.DeadLetterList{}, err
+	}
+	v, total, err := s.DeadLetters.Query(ctx, cond)
+	return service.DeadLetterList{
+		Letters: v,
+		Total:   total,
+	}, err
+}
+
+func (s *webHookServiceImpl) DeadLetter(ctx context.Context, id string, letterId string) (deadletter.Letter, error) {
+	if s.DeadLetters == nil {
+		return deadletter.Letter{}, DeadLetterDisabledErr
+	}
+	if err := s.own(ctx, id); err != nil {
+		return deadletter.Letter{}, err
+	}
+	v, err := s.DeadLetters.Get(ctx, letterId)
+	if err != nil {
+		return deadletter.Letter{}, err
+	}
+	if v.WebhookID != id {
+		return deadletter.Letter{}, fmt.Errorf("Dead letter %s not found ", letterId)
+	}
+	return v, nil
+}
+
+func (s *webHookServiceImpl) ReplayDeadLetter(ctx context.Context, id string, letterId string) error {
+	v, err := s.DeadLetter(ctx, id, letterId)
+	if err != nil {
+		return err
+	}
+	_, err = s.Manager.Send(ctx, id, &events.Event{
+		Type:    v.EventType,
+		PayLoad: v.PayLoad,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	return s.DeadLetters.Delete(ctx, letterId)
+}
+
+func (s *webHookServiceImpl) PurgeDeadLetters(ctx context.Context, id string) error {
+	if s.DeadLetters == nil {
+		return DeadLetterDisabledErr
+	}
+	if err := s.own(ctx, id); err != nil {
+		return err
+	}
+	return s.DeadLetters.Purge(ctx, id)
+}
+
+func (s *webHookServiceImpl) Deliveries(ctx context.Context, cond deliverylog.QueryCondition) (service.DeliveryList, error) {
+	if s.DeliveryLog == nil {
+		return service.DeliveryList{}, DeliveryLogDisabledErr
+	}
+	if err := s.own(ctx, cond.WebhookID); err != nil {
+		return service.DeliveryList{}, err
+	}
+	v, total, err := s.DeliveryLog.QueryAttempts(ctx, cond)
+	return service.DeliveryList{
+		Attempts: v,
+		Total:    total,
+	}, err
+}
+
+func (s *webHookServiceImpl) Delivery(ctx context.Context, id string, deliveryId string) (deliverylog.Delivery, error) {
+	if s.DeliveryLog == nil {
+		return deliverylog.Delivery{}, DeliveryLogDisabledErr
+	}
+	if err := s.own(ctx, id); err != nil {
+		return deliverylog.Delivery{}, err
+	}
+	v, err := s.DeliveryLog.Get(ctx, deliveryId)
+	if err != nil {
+		return deliverylog.Delivery{}, err
+	}
+	if v.WebhookID != id {
+		return deliverylog.Delivery{}, fmt.Errorf("Delivery %s not found ", deliveryId)
+	}
+	return v, nil
+}
+
+func (s *webHookServiceImpl) Redeliver(ctx context.Context, id string, deliveryId string) (service.SendResult, error) {
+	resp, err := s.Manager.Redeliver(ctx, id, deliveryId)
+	if resp == nil {
+		return service.SendResult{}, err
+	}
+	return service.NewSendResult(resp), nil
+}
+
+func (s *webHookServiceImpl) RotateSecret(ctx context.Context, id string, grace time.Duration) (service.SecretRotation, error) {
+	if grace <= 0 {
+		grace = DefaultSecretGrace
+		if s.SecretGrace > 0 {
+			grace = time.Duration(s.SecretGrace) * time.Second
+		}
+	}
+	secret, err := auth.NewStandardSecret()
+	if err != nil {
+		return service.SecretRotation{}, err
+	}
+	expire := time.Now().Add(grace)
+	err = s.Recorder.RotateSecret(ctx, id, secret, expire)
+	if err != nil {
+		return service.SecretRotation{}, err
+	}
+	return service.SecretRotation{
+		Secret:               secret,
+		PreviousSecretExpire: expire,
+	}, nil
+}
+
+func (s *webHookServiceImpl) RevealSecret(ctx context.Context, id string) (service.SecretReveal, error) {
+	v, _, err := s.Recorder.Query(ctx, recorder.QueryCondition{Id: id})
+	if err != nil {
+		return service.SecretReveal{}, err
+	}
+	if len(v) == 0 {
+		return service.SecretReveal{}, fmt.Errorf("ID %s not found ", id)
+	}
+	s.logger.Infof("Secret of webhook %s is revealed\n", id)
+	ret := service.SecretReveal{
+		Secret: v[0].Secret,
+	}
+	if secrets := v[0].Secrets(time.Now()); len(secrets) > 1 {
+		ret.PreviousSecret = secrets[1]
+		ret.PreviousSecretExpire = v[0].PreviousSecretExpire
+	}
+	return ret, nil
+}
+
+func (s *webHookServiceImpl) JWKS(ctx context.Context) (auth.JWKSet, error) {
+	if h, ok := s.Manager.(manager.KeyringHolder); ok {
+		if k := h.Ed25519Keyring(); k != nil {
+			return k.JWKS(), nil
+		}
+	}
+	return auth.JWKSet{}, KeyringDisabledErr
+}
+
+func (s *webHookServiceImpl) Ping(ctx context.Context, id string) (service.SendResult, error) {
+	resp, err := s.Manager.Send(ctx, id, &events.Event{
+		Type: events.PingEventType,
+		PayLoad: events.PingPayload{
+			WebhookID: id,
+			Time:      time.Now(),
+		},
+	}, nil)
+	if resp == nil {
+		return service.SendResult{}, err
+	}
+	return service.NewSendResult(resp), nil
 }
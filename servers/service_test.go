@@ -0,0 +1,133 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package servers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/xfali/neve-webhook/events"
+	"github.com/xfali/neve-webhook/manager"
+	"github.com/xfali/neve-webhook/recorder"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVerification(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d, _ := ioutil.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/reply":
+			v := events.VerificationPayload{}
+			_ = json.Unmarshal(d, &v)
+			_ = json.NewEncoder(w).Encode(events.VerificationReply{Response: v.Token})
+		case "/echo":
+			_, _ = w.Write(d)
+		}
+	}))
+	defer hook.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r := recorder.NewMemRecorder()
+	s := NewWebHookService()
+	s.Recorder = r
+	s.Manager = manager.NewBlockManager(r)
+	s.Verification = true
+
+	v, err := s.Create(ctx, recorder.Input{Url: hook.URL + "/reply", TriggerEventTypes: []string{"push"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.State != recorder.HookStateNormal {
+		t.Fatalf("Expect verified by reply but get %s\n", v.State)
+	}
+	// echoing the challenge does not answer it
+	v, err = s.Create(ctx, recorder.Input{Url: hook.URL + "/echo", TriggerEventTypes: []string{"push"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.State != recorder.HookStatePendingVerification {
+		t.Fatalf("Expect pending but get %s\n", v.State)
+	}
+
+	v, err = s.Create(ctx, recorder.Input{Url: hook.URL + "/silent", TriggerEventTypes: []string{"push"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.State != recorder.HookStatePendingVerification {
+		t.Fatalf("Expect pending but get %s\n", v.State)
+	}
+	if err := s.Update(ctx, v.ID, recorder.Input{State: recorder.HookStateNormal}); err != NotVerifiedErr {
+		t.Fatalf("Expect not verified but get %v\n", err)
+	}
+	if err := s.Verify(ctx, v.ID, "invalid"); err != InvalidTokenErr {
+		t.Fatalf("Expect invalid token but get %v\n", err)
+	}
+	d, _ := s.get(ctx, v.ID)
+	if err := s.Verify(ctx, v.ID, d.VerificationToken); err != nil {
+		t.Fatal(err)
+	}
+	d, _ = s.get(ctx, v.ID)
+	if d.State != recorder.HookStateNormal || len(d.TriggerEventTypes) != 1 {
+		t.Fatalf("Expect normal but get %s %v\n", d.State, d.TriggerEventTypes)
+	}
+}
+
+func TestUpdateMaskedSecrets(t *testing.T) {
+	ctx := context.Background()
+	r := recorder.NewMemRecorder()
+	s := NewWebHookService()
+	s.Recorder = r
+	s.Manager = manager.NewBlockManager(r)
+
+	v, err := s.Create(ctx, recorder.Input{
+		Url:          "http://localhost/test",
+		Secret:       "whsec_test-secret",
+		OutboundAuth: &recorder.OutboundAuth{Type: recorder.OutboundAuthBearer, Token: "test-token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := s.Detail(ctx, v.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// read-modify-write with masked secrets
+	err = s.Update(ctx, v.ID, recorder.Input{
+		Url:          d.Url,
+		Secret:       d.Secret,
+		ContentType:  "application/xml",
+		OutboundAuth: d.OutboundAuth,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := s.get(ctx, v.ID)
+	if stored.Secret != "whsec_test-secret" || stored.OutboundAuth.Token != "test-token" || stored.ContentType != "application/xml" {
+		t.Fatalf("Expect secrets kept but get %s %s\n", stored.Secret, stored.OutboundAuth.Token)
+	}
+	err = s.Update(ctx, v.ID, recorder.Input{
+		OutboundAuth: &recorder.OutboundAuth{Type: recorder.OutboundAuthBasic, Username: "test", Password: d.OutboundAuth.Token},
+	})
+	if err != MaskedSecretErr {
+		t.Fatalf("Expect masked secret error but get %v\n", err)
+	}
+}
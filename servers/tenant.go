@@ -0,0 +1,51 @@
+/*
+ * Copyright (C) 2024, Xiongfa Li.
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package servers
+
+import (
+	"net/http"
+	"strings"
+)
+
+const DefaultTenantHeader = "X-Tenant-ID"
+
+// TenantResolver resolves the tenant of requests, webhooks of a tenant are isolated from others
+// when the recorder is filtered by tenant, see recorder.NewTenantFilter.
+type TenantResolver interface {
+	// ResolveTenant returns the tenant of the request, empty if the request carries none.
+	ResolveTenant(req *http.Request) (string, error)
+}
+
+// headerTenantResolver reads the tenant from a header, it should only be used behind a gateway
+// which sets the header, or with an Authorizer which grants per tenant credentials.
+type headerTenantResolver struct {
+	header string
+}
+
+func NewHeaderTenantResolver(header string) *headerTenantResolver {
+	if header == "" {
+		header = DefaultTenantHeader
+	}
+	return &headerTenantResolver{
+		header: header,
+	}
+}
+
+func (r *headerTenantResolver) ResolveTenant(req *http.Request) (string, error) {
+	return strings.TrimSpace(req.Header.Get(r.header)), nil
+}
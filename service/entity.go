@@ -17,9 +17,85 @@
 
 package service
 
-import "github.com/xfali/neve-webhook/recorder"
+import (
+	"github.com/xfali/neve-webhook/deadletter"
+	"github.com/xfali/neve-webhook/deliverylog"
+	"github.com/xfali/neve-webhook/notifier"
+	"github.com/xfali/neve-webhook/recorder"
+	"time"
+)
 
 type ListData struct {
 	Webhooks []recorder.Data `json:"list" xml:"list" yaml:"list"`
 	Total    int64           `json:"total" xml:"total" yaml:"total"`
 }
+
+// WebhookDetail is a webhook with its runtime state.
+type WebhookDetail struct {
+	recorder.Data `yaml:",inline"`
+	// Nil if the webhook has no rate limit.
+	RateLimiter *RateLimiterState `json:"rate_limiter,omitempty" xml:"rate_limiter,omitempty" yaml:"rate_limiter,omitempty"`
+}
+
+type RateLimiterState struct {
+	// Tokens added per second.
+	Rate float64 `json:"rate" xml:"rate" yaml:"rate"`
+	// Max tokens in the bucket.
+	Burst int `json:"burst" xml:"burst" yaml:"burst"`
+	// Tokens currently available.
+	Tokens float64 `json:"tokens" xml:"tokens" yaml:"tokens"`
+	// Number of deliveries waiting for a token or a worker.
+	Queued int `json:"queued" xml:"queued" yaml:"queued"`
+}
+
+// WebhookCreated carries the secret of the created webhook, it is returned only once.
+type WebhookCreated struct {
+	ID     string `json:"id" xml:"id" yaml:"id"`
+	Secret string `json:"secret" xml:"secret" yaml:"secret"`
+	// pending_verification if the endpoint has not answered the challenge
+	State string `json:"state" xml:"state" yaml:"state"`
+}
+
+type SecretReveal struct {
+	Secret               string    `json:"secret" xml:"secret" yaml:"secret"`
+	PreviousSecret       string    `json:"previous_secret,omitempty" xml:"previous_secret,omitempty" yaml:"previous_secret,omitempty"`
+	PreviousSecretExpire time.Time `json:"previous_secret_expire,omitempty" xml:"previous_secret_expire,omitempty" yaml:"previous_secret_expire,omitempty"`
+}
+
+type SecretRotation struct {
+	Secret string `json:"secret" xml:"secret" yaml:"secret"`
+	// The previous secret is valid until this time
+	PreviousSecretExpire time.Time `json:"previous_secret_expire" xml:"previous_secret_expire" yaml:"previous_secret_expire"`
+}
+
+type DeadLetterList struct {
+	Letters []deadletter.Letter `json:"list" xml:"list" yaml:"list"`
+	Total   int64               `json:"total" xml:"total" yaml:"total"`
+}
+
+// SendResult is the reply of a webhook to a sending.
+type SendResult struct {
+	DeliveryID string        `json:"delivery_id" xml:"delivery_id" yaml:"delivery_id"`
+	StatusCode int           `json:"status_code" xml:"status_code" yaml:"status_code"`
+	Latency    time.Duration `json:"latency" xml:"latency" yaml:"latency"`
+	Body       string        `json:"body" xml:"body" yaml:"body"`
+	Error      string        `json:"error" xml:"error" yaml:"error"`
+}
+
+func NewSendResult(resp *notifier.Response) SendResult {
+	ret := SendResult{
+		DeliveryID: resp.DeliveryID,
+		StatusCode: resp.StatusCode,
+		Latency:    resp.Latency,
+		Body:       string(resp.Body),
+	}
+	if resp.Error != nil {
+		ret.Error = resp.Error.Error()
+	}
+	return ret
+}
+
+type DeliveryList struct {
+	Attempts []deliverylog.Attempt `json:"list" xml:"list" yaml:"list"`
+	Total    int64                 `json:"total" xml:"total" yaml:"total"`
+}
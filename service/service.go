@@ -19,17 +19,61 @@ package service
 
 import (
 	"context"
+	"github.com/xfali/neve-webhook/auth"
+	"github.com/xfali/neve-webhook/deadletter"
+	"github.com/xfali/neve-webhook/deliverylog"
 	"github.com/xfali/neve-webhook/recorder"
+	"time"
 )
 
 type WebHookService interface {
-	Create(ctx context.Context, rec recorder.Input) (string, error)
+	// Create creates the webhook, a secret is generated if it is empty.
+	// Secrets are masked in later queries, see RevealSecret.
+	Create(ctx context.Context, rec recorder.Input) (WebhookCreated, error)
 
 	Update(ctx context.Context, id string, rec recorder.Input) error
 
 	Get(ctx context.Context, cond recorder.QueryCondition) (ListData, error)
 
-	Detail(ctx context.Context, id string) (recorder.Data, error)
+	Detail(ctx context.Context, id string) (WebhookDetail, error)
 
 	Delete(ctx context.Context, id string) error
+
+	// ListDeadLetters lists deliveries of the webhook which exhausted retries.
+	ListDeadLetters(ctx context.Context, cond deadletter.QueryCondition) (DeadLetterList, error)
+
+	DeadLetter(ctx context.Context, id string, letterId string) (deadletter.Letter, error)
+
+	// ReplayDeadLetter sends the dead letter to the webhook again, the letter is removed if succeeded.
+	ReplayDeadLetter(ctx context.Context, id string, letterId string) error
+
+	// PurgeDeadLetters deletes all dead letters of the webhook.
+	PurgeDeadLetters(ctx context.Context, id string) error
+
+	// Deliveries lists delivery attempts of the webhook, newest first.
+	Deliveries(ctx context.Context, cond deliverylog.QueryCondition) (DeliveryList, error)
+
+	Delivery(ctx context.Context, id string, deliveryId string) (deliverylog.Delivery, error)
+
+	// Redeliver sends the original payload of the delivery again, the reply of the webhook is returned even if it failed.
+	Redeliver(ctx context.Context, id string, deliveryId string) (SendResult, error)
+
+	// RotateSecret generates a new secret for the webhook, the current one is kept valid in the grace period.
+	// grace <= 0 means the default grace period.
+	RotateSecret(ctx context.Context, id string, grace time.Duration) (SecretRotation, error)
+
+	// RevealSecret returns valid secrets of the webhook in plaintext, it is a privileged operation.
+	RevealSecret(ctx context.Context, id string) (SecretReveal, error)
+
+	// JWKS returns public keys verifying signatures of messages.
+	JWKS(ctx context.Context) (auth.JWKSet, error)
+
+	// Challenge sends the challenge to the webhook pending verification again, it becomes normal if the token is answered.
+	Challenge(ctx context.Context, id string) (SendResult, error)
+
+	// Verify confirms the webhook pending verification by the challenge token.
+	Verify(ctx context.Context, id string, token string) error
+
+	// Ping sends a ping event to the webhook, the reply of the webhook is returned even if it failed.
+	Ping(ctx context.Context, id string) (SendResult, error)
 }
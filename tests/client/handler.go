@@ -43,7 +43,7 @@ func NewTestHandler() *TestHandler {
 }
 
 func (o *TestHandler) BeanAfterSet() error {
-	id, err := o.Cli.Create(context.Background(), recorder.Input{
+	v, err := o.Cli.Create(context.Background(), recorder.Input{
 		Url:    o.Endpoint,
 		Secret: "just-test",
 		TriggerEventTypes: []string{
@@ -53,7 +53,7 @@ func (o *TestHandler) BeanAfterSet() error {
 	if err != nil {
 		return err
 	}
-	o.id = id
+	o.id = v.ID
 	return nil
 }
 
@@ -49,29 +49,21 @@ func (o *Service) BeanAfterSet() error {
 			case <-o.stopChan:
 				return
 			case <-ticker.C:
-				ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 				resps, err := o.Manager.Notify(ctx, &events.Event{
 					Type:    "push",
 					PayLoad: result.Ok("This is a test"),
 				}, serialize.DeserializeFunc(func(bytes []byte) (interface{}, error) {
 					return string(bytes), nil
 				}))
-				if resps != nil {
-					end := false
-					for {
-						select {
-						case <-ctx.Done():
-							o.logger.Errorln(ctx.Err())
-							end = true
-						case v := <-resps:
-							o.logger.Infoln("Response: ", v)
-						}
-						if end {
-							break
-						}
+				if err != nil {
+					o.logger.Infoln("Notify error: ", err)
+				} else {
+					for v := range resps {
+						o.logger.Infoln("Response: ", v)
 					}
 				}
-				o.logger.Infoln("Notify error: ", err)
+				cancel()
 			}
 		}
 	}()